@@ -1,7 +1,10 @@
 package executor
 
 import (
+	"context"
+	"log"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/gavincmartin/rotor-control-service/integrations"
@@ -9,25 +12,81 @@ import (
 	"github.com/gavincmartin/rotor-control-service/rotor"
 )
 
+const (
+	// rateInterval is how often rates are commanded during rate tracking
+	rateInterval = 200 * time.Millisecond
+	// leaseHolder is the name under which the Executor holds the rotor's
+	// control lease while tracking a pass
+	leaseHolder = "executor"
+	// leaseMargin is how long the Executor's lease outlasts the pass it is
+	// tracking
+	leaseMargin = 1 * time.Minute
+)
+
+// LeasePolicy decides what the Executor does when a pass is due to start
+// while someone else (e.g. an operator) holds the rotor's control lease
+type LeasePolicy string
+
+// LeasePolicies
+const (
+	// LeaseWait waits for the lease to be released or expire, then tracks
+	// the rest of the pass
+	LeaseWait LeasePolicy = "wait"
+	// LeaseSkip skips the pass
+	LeaseSkip LeasePolicy = "skip"
+	// LeasePreempt takes the lease over and tracks the pass
+	LeasePreempt LeasePolicy = "preempt"
+)
+
 // Executor stores the relevant rotor controller object, the database in which
 // TrackingPass objects are stored, a channel that receives updates when a
 // POST, PUT, or DELETE request is made to the service, the next TrackingPass in the
-// future, and a boolean value for whether the Executor is engaged (so that
-// only one pass will be tracked at once)
+// future, and whether the Executor is engaged (so that only one pass will be
+// tracked at once). If StowAfterPass is set, the rotor is sent to its stow
+// position once it has sat idle (without being commanded) for StowDelay after
+// a pass.
 type Executor struct {
 	Rotctl        *rotor.Rotor
 	DB            passes.DAO
 	Updates       <-chan struct{}
 	AbortCommands <-chan struct{}
 	NextPass      passes.TrackingPass
-	Engaged       bool
+	Planner       Planner
+	StowAfterPass bool
+	StowDelay     time.Duration
+	// RateTracking tracks passes by commanding rates rather than positions
+	// (for smooth, continuous motion) on rotors that support it
+	RateTracking bool
+	// RateGain is how strongly position error is corrected in rate tracking,
+	// in degrees per second per degree of error
+	RateGain float64
+	// LeasePolicy decides what happens to a pass when someone else holds the
+	// rotor's control lease
+	LeasePolicy LeasePolicy
+	// tracked is the ID of the last pass engaged, so that a pass whose
+	// tracking ends before it starts isn't engaged again, and blocked is the
+	// ID of the last pass logged as blocked by the rotor
+	tracked   string
+	blocked   string
+	mu        sync.Mutex
+	engaged   bool
+	stowMu    sync.Mutex
+	stowTimer *time.Timer
+}
+
+// Engaged reports whether the Executor is tracking a pass
+func (e *Executor) Engaged() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.engaged
 }
 
 // Run loops the executor indefinitely, updating its NextPass attribute if
 // a POST, PUT, or DELETE request is made at the service level. If a TrackingPass
 // is about to start (in < 1 min) and the Executor is not currently engaged,
 // it will start a goroutine that performs rotor rotation for the duration of
-// the TrackingPass
+// the TrackingPass. A pass isn't engaged while the rotor is blocked (e.g. its
+// emergency stop is latched), but is if the rotor is reset before it starts.
 func (e *Executor) Run() {
 	for {
 		select {
@@ -37,14 +96,35 @@ func (e *Executor) Run() {
 		// no update
 		default:
 			// if the next TrackingPass starts within 1 minute (and is in the future)
-			if time.Until(e.NextPass.StartTime) <= 1*time.Minute && time.Now().Before(e.NextPass.StartTime) && !e.Engaged {
-				integrations.SendSlackPass(e.NextPass)
+			startsSoon := time.Until(e.NextPass.StartTime) <= 1*time.Minute && time.Now().Before(e.NextPass.StartTime)
+			if blocked := e.Rotctl.Blocked(); startsSoon && !e.Engaged() && blocked != nil {
+				// don't track passes until the emergency stop or fault is
+				// reset, or the rotor is homed
+				if e.blocked != e.NextPass.ID.Hex() {
+					log.Printf("Not tracking pass %v until the rotor is reset: %v", e.NextPass.ID.Hex(), blocked)
+					e.blocked = e.NextPass.ID.Hex()
+				}
+				time.Sleep(3 * time.Second)
+			} else if startsSoon && !e.Engaged() && e.tracked != e.NextPass.ID.Hex() {
+				pass := e.NextPass
+				integrations.SendSlackPass(pass)
 				e.engage()
+				// a pass that ends before it starts (e.g. it was skipped for
+				// the lease or aborted) is still the next pass, so make sure
+				// it isn't engaged again
+				e.tracked = pass.ID.Hex()
 				go func() {
-					e.TrackPass(e.NextPass)
+					if err := e.TrackPass(pass); err != nil {
+						log.Printf("Pass %v aborted: %v", pass.ID.Hex(), err)
+					}
 					e.NextPass, _ = e.DB.GetNextPass()
+					e.scheduleStow()
 				}()
 			} else {
+				if id := e.NextPass.ID.Hex(); !e.Engaged() && (e.tracked == id || e.blocked == id) && time.Now().After(e.NextPass.StartTime) {
+					// a skipped pass has started, so move on to the one after it
+					e.NextPass, _ = e.DB.GetNextPass()
+				}
 				time.Sleep(3 * time.Second)
 			}
 		}
@@ -54,42 +134,253 @@ func (e *Executor) Run() {
 // TrackPass carries out the automated execution of a given TrackingPass,
 // rotating the rotor to ensure that it is always within 1 degree of the target
 // State at a given time. Linear interpolation is used between times to estimate
-// the appropriate Az/El. Additionally, there exists an abort channel that will
-// stop the tracking and disengage the Executor.
+// the appropriate Az/El. The pass is planned before it starts (see
+// Planner.Plan) so that it can be tracked flipped and without unwinding the
+// cable wrap when needed. Additionally, there exists an abort channel that will
+// stop the tracking (including any rotation in progress) and disengage the
+// Executor. If the rotor fails to carry out a rotation, tracking stops and the
+// error is returned.
 func (e *Executor) TrackPass(pass passes.TrackingPass) error {
+	// passes stored before they were validated on the way in can't be
+	// tracked safely
+	if err := pass.Validate(e.Rotctl.Limits()); err != nil {
+		e.disengage()
+		return err
+	}
 	endTime := pass.Times[len(pass.Times)-1]
 
-	// Perform the initial rotation
-	e.Rotctl.Rotate(pass.States[0])
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-e.AbortCommands:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := e.acquireLease(ctx, pass); err != nil {
+		return e.finishPass(ctx, err)
+	}
+	defer e.Rotctl.ReleaseLease(leaseHolder)
+
+	// plan within the rotor's current limits, which move with its calibration
+	planner := e.Planner
+	planner.Limits = e.Rotctl.Limits()
+	plan := planner.Plan(pass, e.Rotctl.MechanicalPosition().Az)
+	log.Printf("Pass %v planned: flip %v, flip at culmination %v, continuous %v, peak azimuth rate %.2f deg/s", pass.ID.Hex(), plan.Flip, plan.FlipAtCulmination, plan.Continuous, plan.PeakAzRate)
+	if plan.TooFast {
+		log.Printf("Pass %v needs a faster azimuth rate than the rotor's %.2f deg/s, so tracking will fall behind", pass.ID.Hex(), e.Planner.MaxAzRate)
+	}
+
+	// Perform the initial rotation, to the first state of the pass that isn't
+	// inside an obstruction (e.g. below a horizon mask)
+	if s, ok := e.initialState(pass, plan); ok {
+		if err := e.rotateTo(ctx, plan, s); err != nil && !holdable(err) {
+			return e.finishPass(ctx, err)
+		}
+	}
 
 	// Sleep until the pass starts
-	for time.Now().Before(pass.StartTime) {
-		time.Sleep(1 * time.Second)
+	select {
+	case <-ctx.Done():
+		return e.finishPass(ctx, nil)
+	case <-time.After(time.Until(pass.StartTime)):
+	}
+
+	if e.RateTracking && plan.Continuous && e.Rotctl.Capabilities().Velocity {
+		return e.finishPass(ctx, e.trackRate(ctx, pass, plan))
 	}
 
 	// Loop until the pass is over, interpolating between state values
-	idxNextTime := 0
+	idxNextTime := 1
 	for now := time.Now(); now.Before(endTime) || now.Equal(endTime); now = time.Now() {
-		select {
-		case <-e.AbortCommands:
-			e.disengage()
-			return nil
-		default:
-			for pass.Times[idxNextTime].Before(now) {
-				idxNextTime++
+		if ctx.Err() != nil {
+			return e.finishPass(ctx, nil)
+		}
+		for pass.Times[idxNextTime].Before(now) {
+			idxNextTime++
+		}
+		targetState := interpolateState(plan.States[idxNextTime], plan.States[idxNextTime-1], pass.Times[idxNextTime], pass.Times[idxNextTime-1], now)
+		if e.offTarget(plan, targetState) {
+			err := e.rotateTo(ctx, plan, targetState)
+			if holdable(err) {
+				// hold position until the pass comes back out of the
+				// obstruction, or the motors have rested
+				select {
+				case <-ctx.Done():
+				case <-time.After(1 * time.Second):
+				}
+			} else if err != nil {
+				return e.finishPass(ctx, err)
 			}
-			targetState := interpolateState(pass.States[idxNextTime], pass.States[idxNextTime-1], pass.Times[idxNextTime], pass.Times[idxNextTime-1], now)
-			if math.Abs(targetState.Az-e.Rotctl.GetAz()) > 1.0 || math.Abs(targetState.El-e.Rotctl.GetEl()) > 1.0 {
-				e.Rotctl.Rotate(targetState)
-			} else {
-				time.Sleep(1 * time.Second)
+		} else {
+			select {
+			case <-ctx.Done():
+			case <-time.After(1 * time.Second):
 			}
 		}
 	}
-	e.disengage()
+	return e.finishPass(ctx, nil)
+}
+
+// acquireLease takes the rotor's control lease for the duration of a pass,
+// following the LeasePolicy if someone else holds it
+func (e *Executor) acquireLease(ctx context.Context, pass passes.TrackingPass) error {
+	endTime := pass.Times[len(pass.Times)-1]
+	waiting := false
+	for {
+		ttl := time.Until(endTime) + leaseMargin
+		_, err := e.Rotctl.AcquireLease(leaseHolder, rotor.ControllerExecutor, ttl, false)
+		leaseErr, held := err.(*rotor.LeaseError)
+		if !held {
+			return err
+		}
+		switch e.LeasePolicy {
+		case LeasePreempt:
+			log.Printf("Pass %v is preempting the control lease held by %v", pass.ID.Hex(), leaseErr.Holder)
+			_, err := e.Rotctl.AcquireLease(leaseHolder, rotor.ControllerExecutor, ttl, true)
+			return err
+		case LeaseSkip:
+			return err
+		}
+		if !waiting {
+			log.Printf("Pass %v is waiting for %v to release the control lease", pass.ID.Hex(), leaseErr.Holder)
+			waiting = true
+		}
+		if time.Now().After(endTime) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// trackRate tracks a pass (already underway) by commanding rates: the rate of
+// the planned trajectory (feed-forward) plus RateGain times the position
+// error. It is only used for continuous plans, since rate tracking can't
+// unwind the cable wrap partway through.
+func (e *Executor) trackRate(ctx context.Context, pass passes.TrackingPass, plan Plan) error {
+	endTime := pass.Times[len(pass.Times)-1]
+	defer e.Rotctl.Stop()
+
+	ticker := time.NewTicker(rateInterval)
+	defer ticker.Stop()
+	idxNextTime := 1
+	for now := time.Now(); !now.After(endTime); now = time.Now() {
+		for pass.Times[idxNextTime].Before(now) {
+			idxNextTime++
+		}
+		next, prev := plan.States[idxNextTime], plan.States[idxNextTime-1]
+		targetState := interpolateState(next, prev, pass.Times[idxNextTime], pass.Times[idxNextTime-1], now)
+		pos := e.Rotctl.MechanicalPosition()
+		rate := plan.feedForward(pass, idxNextTime)
+		rate.Az += e.RateGain * (targetState.Az - pos.Az)
+		rate.El += e.RateGain * (targetState.El - pos.El)
+		if e.Planner.MaxAzRate > 0 {
+			rate.Az = math.Max(-e.Planner.MaxAzRate, math.Min(e.Planner.MaxAzRate, rate.Az))
+		}
+		if e.obstructed(targetState) {
+			// hold position until the pass comes back out of the obstruction
+			rate = rotor.Velocity{}
+		}
+		if err := e.Rotctl.SetRate(ctx, rate, rotor.ControllerExecutor); err != nil && !holdable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
 	return nil
 }
 
+// initialState returns the first planned state that isn't inside an
+// obstruction, or false if the rest of the pass is obstructed. If the pass is
+// already underway (e.g. after waiting for the lease), it starts from where
+// the pass is now rather than from AOS.
+func (e *Executor) initialState(pass passes.TrackingPass, plan Plan) (rotor.State, bool) {
+	states := plan.States
+	if now := time.Now(); now.After(pass.StartTime) {
+		i := 1
+		for i < len(pass.Times) && !pass.Times[i].After(now) {
+			i++
+		}
+		if i == len(pass.Times) {
+			return rotor.State{}, false
+		}
+		current := interpolateState(plan.States[i], plan.States[i-1], pass.Times[i], pass.Times[i-1], now)
+		states = append([]rotor.State{current}, plan.States[i:]...)
+	}
+	for _, s := range states {
+		if !e.obstructed(s) {
+			return s, true
+		}
+	}
+	return rotor.State{}, false
+}
+
+// obstructed reports whether a planned state is inside one of the rotor's
+// obstructions
+func (e *Executor) obstructed(s rotor.State) bool {
+	for _, o := range e.Rotctl.Obstructions() {
+		if o.Contains(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// holdable reports whether an error from commanding the rotor during a pass
+// only means holding position for now (because the pass is passing through
+// an obstruction, or a motor has used up its duty cycle) rather than aborting
+func holdable(err error) bool {
+	switch err.(type) {
+	case *rotor.ObstructionError, *rotor.DutyCycleError:
+		return true
+	}
+	return false
+}
+
+// finishPass disengages the Executor at the end of a pass, passing on err
+// unless the pass was aborted (in which case any error is just a consequence
+// of the abort)
+func (e *Executor) finishPass(ctx context.Context, err error) error {
+	e.disengage()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// rotateTo moves the rotor to a planned state: straight to the mechanical
+// position if the plan is continuous, or by the shortest path otherwise
+func (e *Executor) rotateTo(ctx context.Context, plan Plan, s rotor.State) error {
+	if plan.Continuous {
+		return e.Rotctl.RotateMechanical(ctx, s, rotor.ControllerExecutor)
+	}
+	return e.Rotctl.Rotate(ctx, rotor.State{Az: rotor.NormalizeAz(s.Az), El: s.El}, rotor.ControllerExecutor)
+}
+
+// offTarget reports whether the rotor is more than 1 degree away from a
+// planned state on either axis
+func (e *Executor) offTarget(plan Plan, s rotor.State) bool {
+	if plan.Continuous {
+		pos := e.Rotctl.MechanicalPosition()
+		return math.Abs(s.Az-pos.Az) > 1.0 || math.Abs(s.El-pos.El) > 1.0
+	}
+	pos := e.Rotctl.Position()
+	return math.Abs(rotor.AzimuthDifference(pos.Az, s.Az)) > 1.0 || math.Abs(s.El-pos.El) > 1.0
+}
+
+// interpolateState linearly interpolates between two planned states (whose
+// azimuths have been unwrapped, so 359 -> 361 passes through 360 rather than
+// 180)
 func interpolateState(s1, s2 rotor.State, t1, t2, targetTime time.Time) rotor.State {
 	ratio := targetTime.Sub(t1).Seconds() / t2.Sub(t1).Seconds()
 	az := (s2.Az-s1.Az)*ratio + s1.Az
@@ -98,13 +389,58 @@ func interpolateState(s1, s2 rotor.State, t1, t2, targetTime time.Time) rotor.St
 }
 
 func (e *Executor) engage() {
-	if !e.Engaged {
-		e.Engaged = true
+	e.cancelStow()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.engaged = true
+}
+
+// scheduleStow parks the rotor at its stow position once it has gone
+// StowDelay without being commanded, unless another pass has been engaged by
+// then
+func (e *Executor) scheduleStow() {
+	if !e.StowAfterPass {
+		return
 	}
+	e.stowMu.Lock()
+	defer e.stowMu.Unlock()
+	if e.stowTimer != nil {
+		e.stowTimer.Stop()
+	}
+	e.stowTimer = time.AfterFunc(e.StowDelay, e.stow)
 }
 
-func (e *Executor) disengage() {
-	if e.Engaged {
-		e.Engaged = false
+// stow parks the rotor if it has sat idle for StowDelay, or checks again once
+// it could have (if it has been commanded since the pass, e.g. by an operator)
+func (e *Executor) stow() {
+	if e.Engaged() {
+		return
+	}
+	if idle := time.Since(e.Rotctl.LastCommand()); idle < e.StowDelay {
+		e.stowMu.Lock()
+		defer e.stowMu.Unlock()
+		if e.stowTimer != nil {
+			e.stowTimer = time.AfterFunc(e.StowDelay-idle, e.stow)
+		}
+		return
+	}
+	err := e.Rotctl.Park(context.Background(), rotor.StowPosition, rotor.ControllerPark)
+	if err != nil && err != rotor.ErrSuperseded {
+		log.Printf("Failed to stow rotor: %v", err)
 	}
 }
+
+func (e *Executor) cancelStow() {
+	e.stowMu.Lock()
+	defer e.stowMu.Unlock()
+	if e.stowTimer != nil {
+		e.stowTimer.Stop()
+		e.stowTimer = nil
+	}
+}
+
+func (e *Executor) disengage() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.engaged = false
+}
@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"math"
+	"time"
+
+	"github.com/gavincmartin/rotor-control-service/passes"
+	"github.com/gavincmartin/rotor-control-service/rotor"
+)
+
+// Passes that go nearly overhead swing the azimuth around quickly as they do.
+// With FlipMode, a pass reaching highPassEl (or fastPassEl, if it is too fast
+// for the rotor anyway) is flipped at culmination so that it is tracked over
+// the top instead. The azimuth then still has to turn over at culmination, but
+// only where the elevation is so near 90 degrees that lagging behind there
+// hardly affects the pointing, and afterwards the pass heads back toward the
+// azimuth it rose at rather than away from it.
+const (
+	highPassEl = 85
+	fastPassEl = 70
+)
+
+// Planner decides, before a pass starts, how the rotor will track it
+type Planner struct {
+	Limits rotor.Limits
+	// FlipMode allows passes to be tracked "over the top" as (az+180, 180-el)
+	// on rotors with 0-180 degrees of elevation travel
+	FlipMode bool
+	// MaxAzRate is the fastest the rotor can slew in azimuth, in degrees per
+	// second (0 if unknown)
+	MaxAzRate float64
+}
+
+// Plan describes how a TrackingPass will be tracked
+type Plan struct {
+	// Flip is true if the pass will be tracked as (az+180, 180-el)
+	Flip bool `json:"flip"`
+	// FlipAtCulmination is true if the pass will be tracked normally up to
+	// its highest point (at CulminationTime) and as (az+180, 180-el) after
+	// it, carrying on "over the top" rather than swinging the azimuth around
+	FlipAtCulmination bool      `json:"flip_at_culmination"`
+	CulminationTime   time.Time `json:"culmination_time,omitempty"`
+	// Continuous is true if the whole pass fits within the rotor's azimuth
+	// travel, so that it can be tracked without unwinding the cable wrap
+	// partway through. States are then mechanical positions.
+	Continuous bool `json:"continuous"`
+	// States are the pass states with the azimuth unwrapped so that it
+	// changes continuously (and flipped, if Flip is set)
+	States []rotor.State `json:"states"`
+	// PeakAzRate is the fastest the pass requires the rotor to slew in
+	// azimuth, in degrees per second (apart from turning over at
+	// culmination)
+	PeakAzRate float64 `json:"peak_azimuth_rate"`
+	// TooFast is true if PeakAzRate exceeds the rotor's MaxAzRate, meaning
+	// the rotor will fall behind for part of the pass
+	TooFast bool `json:"too_fast"`
+}
+
+// Plan works out how to track a pass starting with the rotor at the
+// mechanical azimuth from. The pass is tracked normally unless only the
+// flipped orientation fits within the rotor's travel (e.g. a pass crossing the
+// azimuth stop), while a pass that goes nearly overhead is flipped at
+// culmination (see highPassEl). The wrap is chosen ahead of time so that the
+// whole pass can be tracked without unwinding, if that is possible.
+func (p Planner) Plan(pass passes.TrackingPass, from float64) Plan {
+	plan := p.plan(pass, len(pass.States), from)
+	if !p.FlipMode || p.Limits.MaxEl < 180 || len(pass.States) == 0 {
+		return p.rate(plan)
+	}
+	if !plan.Continuous {
+		if flipped := p.plan(pass, 0, from); flipped.Continuous {
+			plan = flipped
+		}
+	}
+	culmination := 0
+	for i, s := range pass.States {
+		if s.El > pass.States[culmination].El {
+			culmination = i
+		}
+	}
+	peak := pass.States[culmination].El
+	tooFast := p.MaxAzRate > 0 && plan.PeakAzRate > p.MaxAzRate
+	if (peak >= highPassEl || tooFast && peak >= fastPassEl) && culmination < len(pass.States)-1 {
+		flipped := p.plan(pass, culmination+1, from)
+		if flipped.Continuous {
+			plan = flipped
+			plan.CulminationTime = pass.Times[culmination]
+		}
+	}
+	return p.rate(plan)
+}
+
+// feedForward is the rate of the planned trajectory between states i-1 and i.
+// A FlipAtCulmination plan turns the azimuth over by up to 180 degrees in the
+// one sample after culmination, so no azimuth feed-forward is given there:
+// the rotor turns over on the position error alone rather than being sent an
+// arbitrarily fast rate.
+func (plan Plan) feedForward(pass passes.TrackingPass, i int) rotor.Velocity {
+	dt := pass.Times[i].Sub(pass.Times[i-1]).Seconds()
+	if dt <= 0 {
+		return rotor.Velocity{}
+	}
+	next, prev := plan.States[i], plan.States[i-1]
+	v := rotor.Velocity{Az: (next.Az - prev.Az) / dt, El: (next.El - prev.El) / dt}
+	if plan.FlipAtCulmination && pass.Times[i-1].Equal(plan.CulminationTime) {
+		v.Az = 0
+	}
+	return v
+}
+
+// rate marks a plan TooFast if it needs the azimuth to move faster than the
+// rotor can
+func (p Planner) rate(plan Plan) Plan {
+	if p.MaxAzRate > 0 && plan.PeakAzRate > p.MaxAzRate {
+		plan.TooFast = true
+	}
+	return plan
+}
+
+// plan unwraps the pass's azimuth, flipping the states from index flipFrom
+// onward (so 0 flips the whole pass and len(pass.States) none of it), and
+// fits the result into the rotor's travel
+func (p Planner) plan(pass passes.TrackingPass, flipFrom int, from float64) Plan {
+	states := make([]rotor.State, len(pass.States))
+	minAz, maxAz := math.Inf(1), math.Inf(-1)
+	minEl, maxEl := math.Inf(1), math.Inf(-1)
+	peakRate := 0.0
+	for i, s := range pass.States {
+		if i >= flipFrom {
+			s = rotor.State{Az: rotor.NormalizeAz(s.Az + 180), El: 180 - s.El}
+		}
+		switch {
+		case i > 0 && i == flipFrom:
+			// turning over at culmination, the azimuth heads back toward
+			// where the pass rose rather than on around
+			s.Az = states[0].Az + rotor.AzimuthDifference(states[0].Az, s.Az)
+		case i > 0:
+			prev := states[i-1]
+			s.Az = prev.Az + rotor.AzimuthDifference(prev.Az, s.Az)
+			if dt := pass.Times[i].Sub(pass.Times[i-1]).Seconds(); dt > 0 {
+				peakRate = math.Max(peakRate, math.Abs(s.Az-prev.Az)/dt)
+			}
+		}
+		states[i] = s
+		minAz, maxAz = math.Min(minAz, s.Az), math.Max(maxAz, s.Az)
+		minEl, maxEl = math.Min(minEl, s.El), math.Max(maxEl, s.El)
+	}
+	plan := Plan{
+		Flip:              flipFrom == 0,
+		FlipAtCulmination: flipFrom > 0 && flipFrom < len(states),
+		States:            states,
+		PeakAzRate:        peakRate,
+	}
+	if len(states) == 0 || minEl < p.Limits.MinEl || maxEl > p.Limits.MaxEl {
+		return plan
+	}
+
+	// find the whole number of turns that puts the entire pass within the
+	// azimuth travel, preferring the one that starts closest to the rotor
+	lo := math.Ceil((p.Limits.MinAz - minAz) / 360)
+	hi := math.Floor((p.Limits.MaxAz - maxAz) / 360)
+	if lo > hi {
+		return plan
+	}
+	turns := lo
+	for k := lo + 1; k <= hi; k++ {
+		if math.Abs(states[0].Az+360*k-from) < math.Abs(states[0].Az+360*turns-from) {
+			turns = k
+		}
+	}
+	for i := range states {
+		states[i].Az += 360 * turns
+	}
+	plan.Continuous = true
+	return plan
+}
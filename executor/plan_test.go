@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gavincmartin/rotor-control-service/passes"
+	"github.com/gavincmartin/rotor-control-service/rotor"
+)
+
+// overheadPass is a pass rising in the south and setting in the north that
+// culminates in the east at maxEl, sampled every 5 seconds
+func overheadPass(maxEl float64) passes.TrackingPass {
+	var pass passes.TrackingPass
+	start := time.Now().Add(time.Hour)
+	tilt := maxEl * math.Pi / 180
+	const n = 60
+	for i := 0; i < n; i++ {
+		t := math.Pi * float64(i) / (n - 1)
+		east, north, up := math.Sin(t)*math.Cos(tilt), -math.Cos(t), math.Sin(t)*math.Sin(tilt)
+		pass.States = append(pass.States, rotor.State{
+			Az: rotor.NormalizeAz(math.Atan2(east, north) * 180 / math.Pi),
+			El: math.Asin(up) * 180 / math.Pi,
+		})
+		pass.Times = append(pass.Times, start.Add(time.Duration(i)*5*time.Second))
+	}
+	pass.StartTime = pass.Times[0]
+	return pass
+}
+
+func TestPlanFlipAtCulmination(t *testing.T) {
+	limits := rotor.Limits{MinAz: -180, MaxAz: 540, MinEl: 0, MaxEl: 180}
+	for _, tc := range []struct {
+		name    string
+		planner Planner
+		maxEl   float64
+		want    bool
+	}{
+		{"overhead", Planner{Limits: limits, FlipMode: true}, 88, true},
+		{"low", Planner{Limits: limits, FlipMode: true}, 30, false},
+		{"fast", Planner{Limits: limits, FlipMode: true, MaxAzRate: 1}, 75, true},
+		{"keeping up", Planner{Limits: limits, FlipMode: true, MaxAzRate: 10}, 75, false},
+		{"no flip mode", Planner{Limits: limits}, 88, false},
+		{"no travel over the top", Planner{Limits: rotor.DefaultLimits, FlipMode: true}, 88, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pass := overheadPass(tc.maxEl)
+			plan := tc.planner.Plan(pass, 180)
+			if plan.FlipAtCulmination != tc.want {
+				t.Fatalf("flip at culmination %v, want %v", plan.FlipAtCulmination, tc.want)
+			}
+			if !plan.Continuous || plan.Flip {
+				t.Errorf("continuous %v, flip %v", plan.Continuous, plan.Flip)
+			}
+			if !tc.want {
+				return
+			}
+			first, last := plan.States[0], plan.States[len(plan.States)-1]
+			if last.El < 170 || math.Abs(last.Az-first.Az) > 5 {
+				t.Errorf("pass set at %v, want over the top near where it rose (%v)", last, first)
+			}
+			for i, s := range plan.States {
+				if flipped := pass.Times[i].After(plan.CulminationTime); flipped != (s.El > 90) {
+					t.Errorf("state %d (%v) at %v, culmination at %v", i, s, pass.Times[i], plan.CulminationTime)
+				}
+			}
+		})
+	}
+}
+
+func TestFeedForwardAcrossFlip(t *testing.T) {
+	limits := rotor.Limits{MinAz: -180, MaxAz: 540, MinEl: 0, MaxEl: 180}
+	pass := overheadPass(89)
+	plan := Planner{Limits: limits, FlipMode: true}.Plan(pass, 180)
+	if !plan.FlipAtCulmination {
+		t.Fatal("pass not flipped at culmination")
+	}
+	turnedOver := false
+	for i := 1; i < len(plan.States); i++ {
+		v := plan.feedForward(pass, i)
+		if pass.Times[i-1].Equal(plan.CulminationTime) {
+			dt := pass.Times[i].Sub(pass.Times[i-1]).Seconds()
+			turnedOver = math.Abs(plan.States[i].Az-plan.States[i-1].Az)/dt > plan.PeakAzRate
+			if v.Az != 0 {
+				t.Errorf("azimuth feed-forward %.2f deg/s across the flip, want none", v.Az)
+			}
+			continue
+		}
+		if math.Abs(v.Az) > plan.PeakAzRate+1e-9 {
+			t.Errorf("azimuth feed-forward %.2f deg/s at state %d, over the plan's peak %.2f deg/s", v.Az, i, plan.PeakAzRate)
+		}
+	}
+	if !turnedOver {
+		t.Error("the azimuth didn't turn over after culmination")
+	}
+}
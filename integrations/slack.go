@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gavincmartin/rotor-control-service/passes"
+	"github.com/gavincmartin/rotor-control-service/rotor"
 	"github.com/spf13/viper"
 )
 
@@ -43,6 +45,22 @@ func SendSlackPass(pass passes.TrackingPass) {
 	defer resp.Body.Close()
 }
 
+// SendSlackFault POSTs a rotor Fault to a specified slack URL
+func SendSlackFault(f rotor.Fault) {
+	slackPOSTUrl := viper.GetString("SlackPOSTUrl")
+	if len(slackPOSTUrl) == 0 {
+		return
+	}
+	payload := formatFault(f)
+	resp, err := http.Post(slackPOSTUrl, "application/json", bytes.NewBuffer(payload))
+	if err != nil {
+		// don't take the service down over a notification about the rotor
+		log.Printf("Failed to send fault to Slack: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+}
+
 func formatSchedule(schedule []passes.TrackingPass) []byte {
 	attachments := make([]attachment, len(schedule))
 	for i, pass := range schedule {
@@ -59,6 +77,17 @@ func formatSinglePass(pass passes.TrackingPass) []byte {
 	return payload.ToJSON()
 }
 
+func formatFault(f rotor.Fault) []byte {
+	fields := []field{
+		{Title: "position", Value: fmt.Sprintf("%.1f, %.1f", f.Position.Az, f.Position.El), Short: true},
+		{Title: "target", Value: fmt.Sprintf("%.1f, %.1f", f.Target.Az, f.Target.El), Short: true},
+	}
+	attachments := []attachment{{Fields: fields, AuthorName: f.Message}}
+	text := fmt.Sprintf("The rotor has stopped with a %v fault and won't move until it's reset! :rotating_light:", f.Code)
+	payload := slackPayload{Text: text, Attachments: attachments}
+	return payload.ToJSON()
+}
+
 type slackPayload struct {
 	Text        string       `json:"text"`
 	Attachments []attachment `json:"attachments"`
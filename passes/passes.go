@@ -2,6 +2,7 @@ package passes
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -17,12 +18,65 @@ type TrackingPass struct {
 	Times      []time.Time   `json:"times" bson:"times"`
 	States     []rotor.State `json:"states" bson:"states"`
 	StartTime  time.Time     `json:"start_time" bson:"start_time"`
+	// Obstructed lists the samples that fall inside one of the rotor's
+	// obstructions (which are skipped while tracking)
+	Obstructed []int `json:"obstructed_samples,omitempty" bson:"obstructed_samples,omitempty"`
 }
 
 func (t TrackingPass) String() string {
 	return fmt.Sprintf("S/C: %v | Start: %v | End %v | ID: %v", t.Spacecraft, t.Times[0], t.Times[len(t.Times)-1], t.ID.Hex())
 }
 
+// SampleError describes a state in a TrackingPass that falls outside of a
+// rotor's limits
+type SampleError struct {
+	Sample int       `json:"sample"`
+	Time   time.Time `json:"time"`
+	*rotor.LimitError
+}
+
+func (e *SampleError) Error() string {
+	return fmt.Sprintf("sample %d (%v): %v", e.Sample, e.Time.Format(time.RFC3339), e.LimitError)
+}
+
+// Validate checks that a TrackingPass has a time for each of at least two
+// states, with the times strictly increasing, and that every state is within
+// a rotor's Limits, returning a *SampleError for the first one that isn't
+func (t TrackingPass) Validate(l rotor.Limits) error {
+	if len(t.Times) != len(t.States) {
+		return fmt.Errorf("passes: a pass needs a time for each state (got %d times and %d states)", len(t.Times), len(t.States))
+	}
+	if len(t.States) < 2 {
+		return errors.New("passes: a pass needs at least two samples")
+	}
+	for i := 1; i < len(t.Times); i++ {
+		if !t.Times[i].After(t.Times[i-1]) {
+			return fmt.Errorf("passes: sample %d (%v) isn't after the sample before it", i, t.Times[i].Format(time.RFC3339))
+		}
+	}
+	for i, s := range t.States {
+		if err := l.Validate(s); err != nil {
+			return &SampleError{Sample: i, Time: t.Times[i], LimitError: err.(*rotor.LimitError)}
+		}
+	}
+	return nil
+}
+
+// ObstructedSamples returns the index of every state in a TrackingPass that
+// falls inside one of a rotor's Obstructions
+func (t TrackingPass) ObstructedSamples(obs []rotor.Obstruction) []int {
+	var samples []int
+	for i, s := range t.States {
+		for _, o := range obs {
+			if o.Contains(s) {
+				samples = append(samples, i)
+				break
+			}
+		}
+	}
+	return samples
+}
+
 // ToJSON marhsals a TrackingPass struct into JSON format
 func (t TrackingPass) ToJSON() []byte {
 	jsonData, err := json.Marshal(t)
@@ -66,6 +120,8 @@ func FromJSON(data []byte) TrackingPass {
 	if err != nil {
 		panic(err)
 	}
-	t.StartTime = t.Times[0]
+	if len(t.Times) > 0 {
+		t.StartTime = t.Times[0]
+	}
 	return t
 }
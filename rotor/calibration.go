@@ -0,0 +1,67 @@
+package rotor
+
+import (
+	"errors"
+	"math"
+)
+
+// Calibration corrects for how a rotor is mounted and referenced. It sits
+// between the Rotor (whose positions are true bearings and elevations) and
+// the Driver: commands are converted with ToDriver and reported positions
+// with FromDriver. The zero Calibration leaves positions unchanged.
+type Calibration struct {
+	// NorthAlignment is the true azimuth at which the rotor's mechanical
+	// zero points (e.g. 3.5 if the rotor reads 0 when aimed 3.5 degrees east
+	// of true north)
+	NorthAlignment float64 `json:"north_alignment" bson:"north_alignment"`
+	// AzOffset is added to every azimuth sent to the Driver (e.g. to correct
+	// the zero point of the azimuth encoder)
+	AzOffset float64 `json:"azimuth_offset" bson:"azimuth_offset"`
+	// ElOffset is added to every elevation sent to the Driver
+	ElOffset float64 `json:"elevation_offset" bson:"elevation_offset"`
+	// ElScale multiplies every elevation sent to the Driver (0 is treated as
+	// 1), for elevation readouts that don't span exactly 90 degrees
+	ElScale float64 `json:"elevation_scale" bson:"elevation_scale"`
+}
+
+// Validate checks that a Calibration is usable
+func (c Calibration) Validate() error {
+	for _, v := range []float64{c.NorthAlignment, c.AzOffset, c.ElOffset, c.ElScale} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return errors.New("rotor: calibration values must be finite")
+		}
+	}
+	if c.ElScale < 0 {
+		return errors.New("rotor: calibration elevation scale must not be negative")
+	}
+	return nil
+}
+
+// ToDriver converts a position into the Driver's coordinates
+func (c Calibration) ToDriver(s State) State {
+	return State{
+		Az: s.Az - c.NorthAlignment + c.AzOffset,
+		El: s.El*c.elScale() + c.ElOffset,
+	}
+}
+
+// FromDriver converts a position reported by the Driver back out of its
+// coordinates (the inverse of ToDriver)
+func (c Calibration) FromDriver(s State) State {
+	return State{
+		Az: s.Az + c.NorthAlignment - c.AzOffset,
+		El: (s.El - c.ElOffset) / c.elScale(),
+	}
+}
+
+// rateToDriver converts a rate into the Driver's coordinates
+func (c Calibration) rateToDriver(v Velocity) Velocity {
+	return Velocity{Az: v.Az, El: v.El * c.elScale()}
+}
+
+func (c Calibration) elScale() float64 {
+	if c.ElScale == 0 {
+		return 1
+	}
+	return c.ElScale
+}
@@ -0,0 +1,61 @@
+package rotor
+
+import (
+	"math"
+)
+
+// Compensation describes how commands are adjusted for the rotor's gear
+// train. Backlash is compensated by always making the final approach to a
+// target in the positive direction (clockwise/up): a move in the negative
+// direction first overshoots the target by the backlash. Corrections smaller
+// than the dead-band aren't sent to the Driver at all. All values are in
+// degrees, and zero disables that compensation.
+type Compensation struct {
+	AzBacklash float64 `json:"azimuth_backlash"`
+	ElBacklash float64 `json:"elevation_backlash"`
+	AzDeadBand float64 `json:"azimuth_dead_band"`
+	ElDeadBand float64 `json:"elevation_dead_band"`
+}
+
+// deadBand holds each axis of a target that is within the dead-band of the
+// current position at that position. It returns false if both axes are, in
+// which case there is nothing to send.
+func (c Compensation) deadBand(pos, target State) (State, bool) {
+	azHeld := math.Abs(target.Az-pos.Az) < c.AzDeadBand
+	elHeld := math.Abs(target.El-pos.El) < c.ElDeadBand
+	if azHeld {
+		target.Az = pos.Az
+	}
+	if elHeld {
+		target.El = pos.El
+	}
+	return target, !(azHeld && elHeld)
+}
+
+// approach splits a move into the legs that compensate for backlash: the
+// first target to send, and the final target to send once it is reached (nil
+// if the first is the final one). The overshoot is kept within the Limits,
+// and is skipped if it would point into or sweep through one of the
+// Obstructions the rotor isn't already inside.
+func (c Compensation) approach(pos, target State, l Limits, obs []Obstruction) (State, *State) {
+	first := target
+	if target.Az < pos.Az && c.AzBacklash > 0 {
+		first.Az = math.Max(target.Az-c.AzBacklash, l.MinAz)
+	}
+	if target.El < pos.El && c.ElBacklash > 0 {
+		first.El = math.Max(target.El-c.ElBacklash, l.MinEl)
+	}
+	if first == target {
+		return target, nil
+	}
+	var avoid []Obstruction
+	for _, o := range obs {
+		if !o.Contains(pos) {
+			avoid = append(avoid, o)
+		}
+	}
+	if sweep(avoid, pos, first) != nil || sweep(avoid, first, target) != nil {
+		return target, nil
+	}
+	return first, &target
+}
@@ -0,0 +1,42 @@
+package rotor
+
+import "testing"
+
+func TestApproach(t *testing.T) {
+	c := Compensation{AzBacklash: 5, ElBacklash: 2}
+	// a zone from azimuth 90 to 100, just below a target at 102
+	wall := Obstruction{Name: "wall", Polygon: []State{{Az: 90, El: 0}, {Az: 100, El: 0}, {Az: 100, El: 30}, {Az: 90, El: 30}}}
+	// a narrow mast that an overshoot to 97 would sweep past
+	mast := Obstruction{Name: "mast", Polygon: []State{{Az: 98.5, El: 0}, {Az: 99.5, El: 0}, {Az: 99.5, El: 60}, {Az: 98.5, El: 60}}}
+	tests := []struct {
+		name     string
+		pos      State
+		target   State
+		obs      []Obstruction
+		first    State
+		overshot bool
+	}{
+		{"positive move", State{Az: 10, El: 10}, State{Az: 20, El: 20}, nil, State{Az: 20, El: 20}, false},
+		{"negative move", State{Az: 120, El: 40}, State{Az: 102, El: 20}, nil, State{Az: 97, El: 18}, true},
+		{"clamped to the limits", State{Az: 20, El: 10}, State{Az: 2, El: 1}, nil, State{Az: 0, El: 0}, true},
+		{"clear of an obstruction", State{Az: 120, El: 40}, State{Az: 110, El: 20}, []Obstruction{wall}, State{Az: 105, El: 18}, true},
+		{"overshoot into an obstruction", State{Az: 120, El: 20}, State{Az: 102, El: 20}, []Obstruction{wall}, State{Az: 102, El: 20}, false},
+		{"overshoot sweeps through an obstruction", State{Az: 120, El: 20}, State{Az: 102, El: 20}, []Obstruction{mast}, State{Az: 102, El: 20}, false},
+		{"already inside an obstruction", State{Az: 98, El: 20}, State{Az: 96, El: 10}, []Obstruction{wall}, State{Az: 91, El: 8}, true},
+	}
+	for _, tt := range tests {
+		first, pending := c.approach(tt.pos, tt.target, DefaultLimits, tt.obs)
+		if first != tt.first {
+			t.Errorf("%v: got first leg %+v, want %+v", tt.name, first, tt.first)
+		}
+		if (pending != nil) != tt.overshot {
+			t.Errorf("%v: got pending %v, want overshoot %v", tt.name, pending, tt.overshot)
+		}
+		if pending != nil && *pending != tt.target {
+			t.Errorf("%v: got final leg %+v, want %+v", tt.name, *pending, tt.target)
+		}
+		if pending == nil && first != tt.target {
+			t.Errorf("%v: got a single leg %+v that isn't the target %+v", tt.name, first, tt.target)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package rotor
+
+import (
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// command is a request to the controller goroutine to move to a target, to
+// move at a rate (if rate is set), to home or to stop. The outcome is
+// delivered on done, which must be buffered so that the controller never
+// blocks on a caller that has gone away.
+type command struct {
+	target     State
+	mechanical bool
+	controller Controller
+	rate       *Velocity
+	home       bool
+	stop       bool
+	done       chan error
+}
+
+// move is the command the controller is currently carrying out, along with
+// the progress checkFeedback has seen it make. The command's target is the
+// current leg; pending is the final target if there is another leg to go (to
+// compensate for backlash).
+type move struct {
+	command
+	pending     *State
+	deadline    time.Time
+	progressPos State
+	progressAt  time.Time
+	closest     float64
+}
+
+// run is the controller loop. It is the only goroutine that talks to the
+// Driver: it applies commands as they arrive (a new target immediately
+// supersedes the previous one), polls the Driver for the position, and
+// publishes each position as a snapshot for readers.
+func (r *Rotor) run() {
+	var active *move
+	// rateUntil is when the current rate command lapses (zero when not in
+	// rate mode), rate is that command and progress is what checkRate has
+	// seen it do
+	var rateUntil time.Time
+	var rate Velocity
+	var progress rateProgress
+	// failures counts the position polls that have failed in a row
+	failures := 0
+	stopRate := func(reason string) {
+		rateUntil = time.Time{}
+		if err := r.driver.Stop(); err != nil {
+			log.Printf("rotor: failed to stop rate mode: %v", err)
+		}
+		log.Printf("rotor: rate mode stopped: %v", reason)
+	}
+	finish := func(err error) {
+		if active != nil {
+			active.done <- err
+			active = nil
+			atomic.StoreInt32(&r.homing, 0)
+		}
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case c := <-r.commands:
+			r.commanded.Store(time.Now())
+			if c.stop {
+				if r.EmergencyStopped() {
+					finish(ErrEmergencyStop)
+				} else {
+					finish(ErrStopped)
+				}
+				rateUntil = time.Time{}
+				c.done <- r.driver.Stop()
+				continue
+			}
+			if err := r.Blocked(); err != nil && !(c.home && err == ErrUnreferenced) {
+				c.done <- err
+				continue
+			}
+			// the active move is only superseded once the new command has
+			// been accepted, so a command that fails leaves it running
+			idle := active == nil && rateUntil.IsZero()
+			if c.rate != nil {
+				vd, ok := r.driver.(VelocityDriver)
+				if !ok || !r.driver.Capabilities().Velocity {
+					c.done <- ErrNotSupported
+					continue
+				}
+				v := r.Calibration().rateToDriver(*c.rate)
+				if err := vd.SetRate(v.Az, v.El); err != nil {
+					c.done <- err
+					continue
+				}
+				finish(ErrSuperseded)
+				if rateUntil.IsZero() || !sameDirection(rate, *c.rate) {
+					progress = newRateProgress(r.MechanicalPosition())
+				}
+				rateUntil, rate = time.Now().Add(rateTimeout), *c.rate
+				c.done <- nil
+				continue
+			}
+			if c.home {
+				h, ok := r.driver.(Homer)
+				if !ok || !r.driver.Capabilities().Homing {
+					c.done <- ErrNotSupported
+					continue
+				}
+				if err := h.Home(); err != nil {
+					c.done <- err
+					continue
+				}
+				finish(ErrSuperseded)
+				rateUntil = time.Time{}
+				log.Printf("rotor: homing started by %v", c.controller)
+				atomic.StoreInt32(&r.homing, 1)
+				active = &move{command: c, deadline: time.Now().Add(HomeTimeout)}
+				continue
+			}
+			target := c.target
+			if !c.mechanical {
+				var err error
+				if target, err = r.mechanicalTarget(c.target); err != nil {
+					c.done <- err
+					continue
+				}
+			}
+			pos := r.MechanicalPosition()
+			comp := r.config.Compensation
+			if idle {
+				var send bool
+				if target, send = comp.deadBand(pos, target); !send {
+					c.done <- nil
+					continue
+				}
+			}
+			leg, pending := comp.approach(pos, target, r.Limits(), r.Obstructions())
+			if err := r.setTarget(leg); err != nil {
+				c.done <- err
+				continue
+			}
+			finish(ErrSuperseded)
+			rateUntil = time.Time{}
+			c.target = leg
+			r.target.Store(&lastTarget{State: target, controller: c.controller})
+			active = &move{
+				command:     c,
+				pending:     pending,
+				deadline:    time.Now().Add(MoveTimeout),
+				progressPos: pos,
+				progressAt:  time.Now(),
+				closest:     distance(pos, leg),
+			}
+
+		case done := <-r.cancels:
+			if active != nil && active.done == done {
+				active = nil
+				atomic.StoreInt32(&r.homing, 0)
+				if err := r.driver.Stop(); err != nil {
+					log.Printf("rotor: failed to stop cancelled move: %v", err)
+				}
+			}
+
+		case <-ticker.C:
+			raw, err := r.driver.Position()
+			if err != nil {
+				if failures++; failures < pollFailures {
+					continue
+				}
+				fb := r.feedback.Load().(feedback)
+				fb.connected = false
+				r.feedback.Store(fb)
+				finish(err)
+				continue
+			}
+			failures = 0
+			pos := r.fromDriver(raw)
+			prev := r.MechanicalPosition()
+			r.updateFeedback(pos, active != nil || !rateUntil.IsZero())
+			r.position.Store(pos)
+			if f := r.hardwareFault(active, pos); f != nil {
+				rateUntil = time.Time{}
+				r.raise(f)
+				finish(f)
+				continue
+			}
+
+			// count motor running time toward the duty cycle, stopping the
+			// rotor if an axis it is driving runs out
+			azOn := math.Abs(pos.Az-prev.Az) > dutyMovement
+			elOn := math.Abs(pos.El-prev.El) > dutyMovement
+			if active != nil && !active.home {
+				azOn = azOn || math.Abs(active.target.Az-pos.Az) > Tolerance
+				elOn = elOn || math.Abs(active.target.El-pos.El) > Tolerance
+			} else if !rateUntil.IsZero() {
+				azOn, elOn = azOn || rate.Az != 0, elOn || rate.El != 0
+			}
+			r.duty.record(azOn, elOn, time.Now())
+			if err := r.duty.check(azOn, elOn); err != nil && (active != nil || !rateUntil.IsZero()) {
+				if !rateUntil.IsZero() {
+					stopRate(err.Error())
+				} else {
+					if err := r.driver.Stop(); err != nil {
+						log.Printf("rotor: failed to stop move out of duty cycle: %v", err)
+					}
+					finish(err)
+				}
+				continue
+			}
+			if !rateUntil.IsZero() {
+				if time.Now().After(rateUntil) {
+					stopRate("no rate commanded in " + rateTimeout.String())
+				} else if err := r.Limits().ValidateMechanical(pos); err != nil {
+					stopRate(err.Error())
+				} else if o, ok := obstructed(r.Obstructions(), pos); ok {
+					stopRate("entered obstruction " + o.Name)
+				} else if f := r.checkRate(&progress, rate, pos); f != nil {
+					rateUntil = time.Time{}
+					r.raise(f)
+				}
+			}
+			if active == nil {
+				continue
+			}
+			if active.home {
+				// homing drives to the limit or index switches, so only
+				// its completion and deadline are checked
+				if r.Referenced() && !r.moving() {
+					log.Printf("rotor: homing complete at %v", pos)
+					finish(nil)
+				} else if time.Now().After(active.deadline) {
+					if err := r.driver.Stop(); err != nil {
+						log.Printf("rotor: failed to stop timed out homing: %v", err)
+					}
+					finish(ErrMoveTimeout)
+				}
+				continue
+			}
+			if math.Abs(active.target.Az-pos.Az) <= Tolerance && math.Abs(active.target.El-pos.El) <= Tolerance && !r.moving() {
+				if active.pending == nil {
+					finish(nil)
+					continue
+				}
+				// start the final leg
+				next := *active.pending
+				if err := r.setTarget(next); err != nil {
+					finish(err)
+					continue
+				}
+				active.target, active.pending = next, nil
+				active.progressPos, active.progressAt, active.closest = pos, time.Now(), distance(pos, next)
+			} else if time.Now().After(active.deadline) {
+				if err := r.driver.Stop(); err != nil {
+					log.Printf("rotor: failed to stop timed out move: %v", err)
+				}
+				finish(ErrMoveTimeout)
+			} else if f := r.checkFeedback(active, pos); f != nil {
+				r.raise(f)
+				finish(f)
+			}
+		}
+	}
+}
+
+// mechanicalTarget converts a target State (with a 0-360 azimuth) into the
+// mechanical azimuth reached by the shortest legal path from the current
+// position
+func (r *Rotor) mechanicalTarget(s State) (State, error) {
+	l := r.Limits()
+	az, ok := l.Unwrap(s.Az, r.MechanicalPosition().Az)
+	if !ok {
+		return State{}, &LimitError{Axis: "azimuth", Value: s.Az, Min: l.MinAz, Max: l.MaxAz}
+	}
+	return State{Az: az, El: s.El}, nil
+}
+
+// setTarget converts a mechanical target into the Driver's coordinates and
+// sends it, unless (once the PointingModel and Calibration are applied) it is
+// outside of the hardware travel, in which case a *LimitError is returned
+func (r *Rotor) setTarget(s State) error {
+	d := r.toDriver(s)
+	if err := r.config.Limits.ValidateMechanical(d); err != nil {
+		return err
+	}
+	return r.driver.SetTarget(d)
+}
+
+// updateFeedback publishes the velocity (from the change since the previous
+// position) and motion state alongside a new position
+func (r *Rotor) updateFeedback(pos State, commanded bool) {
+	prev, now := r.MechanicalPosition(), time.Now()
+	fb := r.feedback.Load().(feedback)
+	if dt := now.Sub(fb.updated).Seconds(); dt > 0 {
+		fb.velocity = Velocity{Az: (pos.Az - prev.Az) / dt, El: (pos.El - prev.El) / dt}
+	}
+	fb.moving = commanded || r.moving()
+	fb.connected = true
+	fb.referenced = referenced(r.driver)
+	fb.updated = now
+	r.feedback.Store(fb)
+}
+
+// referenced reports whether a Driver's position is referenced (Drivers that
+// aren't Homers always are)
+func referenced(d Driver) bool {
+	if h, ok := d.(Homer); ok {
+		return h.Referenced()
+	}
+	return true
+}
+
+// moving reports whether the Driver says it is still in motion, if it can
+func (r *Rotor) moving() bool {
+	if m, ok := r.driver.(MotionReporter); ok {
+		return m.Moving()
+	}
+	return false
+}
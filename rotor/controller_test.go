@@ -0,0 +1,105 @@
+package rotor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// positionOnly is a Simulator that can only be sent to positions
+type positionOnly struct {
+	*Simulator
+}
+
+func (d positionOnly) Capabilities() Capabilities {
+	return Capabilities{Model: "position only", Feedback: true, Stop: true}
+}
+
+// flaky is a Simulator whose next failing position polls fail
+type flaky struct {
+	*Simulator
+	failing int32
+}
+
+var errPoll = errors.New("poll failed")
+
+func (d *flaky) Position() (State, error) {
+	if atomic.AddInt32(&d.failing, -1) >= 0 {
+		return State{}, errPoll
+	}
+	atomic.StoreInt32(&d.failing, 0)
+	return d.Simulator.Position()
+}
+
+func TestPollFailures(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failures int32
+		want     error
+	}{
+		{"transient", 2, nil},
+		{"persistent", 1000, errPoll},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &flaky{Simulator: NewSimulator(State{Az: 10, El: 10}, SimulatorConfig{MaxRate: 20})}
+			r, err := New(d, Config{Limits: DefaultLimits})
+			if err != nil {
+				t.Fatal(err)
+			}
+			done := make(chan error, 1)
+			go func() {
+				done <- r.Rotate(context.Background(), State{Az: 30, El: 20}, ControllerManual)
+			}()
+			time.Sleep(2 * pollInterval)
+			atomic.StoreInt32(&d.failing, tc.failures)
+			select {
+			case err := <-done:
+				if err != tc.want {
+					t.Errorf("move ended with %v, want %v", err, tc.want)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatal("move didn't end")
+			}
+			if connected := r.Status().Connected; connected != (tc.want == nil) {
+				t.Errorf("connected %v after the move", connected)
+			}
+		})
+	}
+}
+
+func TestUnsupportedCommandKeepsMove(t *testing.T) {
+	d := positionOnly{NewSimulator(State{Az: 10, El: 10}, SimulatorConfig{MaxRate: 40})}
+	r, err := New(d, Config{Limits: DefaultLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Rotate(context.Background(), State{Az: 30, El: 20}, ControllerExecutor)
+	}()
+	time.Sleep(2 * pollInterval)
+
+	ctx := context.Background()
+	if err := r.SetRate(ctx, Velocity{Az: 1}, ControllerManual); err != ErrNotSupported {
+		t.Errorf("got %v from SetRate, want ErrNotSupported", err)
+	}
+	if err := r.Home(ctx, ControllerManual); err != ErrNotSupported {
+		t.Errorf("got %v from Home, want ErrNotSupported", err)
+	}
+	if err := r.Rotate(ctx, State{Az: 30, El: 200}, ControllerManual); err == nil {
+		t.Error("a target beyond the limits was accepted")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("move ended with %v, want it to complete", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("move didn't complete")
+	}
+	if pos := r.Position(); distance(pos, State{Az: 30, El: 20}) > Tolerance {
+		t.Errorf("position %v, want 30,20", pos)
+	}
+}
@@ -0,0 +1,69 @@
+package rotor
+
+// Driver is implemented by rotor hardware backends (and the Simulator). A
+// Rotor uses its Driver to command a target State, read back the current
+// position, and halt motion.
+type Driver interface {
+	// SetTarget commands the rotor to begin moving toward a State. It should
+	// return as soon as the command is accepted rather than when the move is
+	// complete.
+	SetTarget(s State) error
+	// Position reports the current position of the rotor
+	Position() (State, error)
+	// Stop halts motion on both axes
+	Stop() error
+	// Capabilities describes what the Driver supports
+	Capabilities() Capabilities
+}
+
+// Capabilities describes the features supported by a Driver
+type Capabilities struct {
+	// Model is a human-readable name for the hardware being driven
+	Model string `json:"model"`
+	// Feedback is true if Position reports a measured (rather than an
+	// assumed) position
+	Feedback bool `json:"feedback"`
+	// Velocity is true if the Driver can be commanded to move at a rate
+	// rather than only to a position
+	Velocity bool `json:"velocity"`
+	// Homing is true if the Driver can re-reference the rotor's position by
+	// homing it
+	Homing bool `json:"homing"`
+	// Stop is true if the Driver can halt the rotor partway through a move
+	Stop bool `json:"stop"`
+}
+
+// MotionReporter is implemented by Drivers that can tell whether the rotor is
+// still in motion. A Rotor waits for such a Driver to report that it has
+// stopped (rather than only for the position to be within Tolerance) before
+// considering a rotation complete.
+type MotionReporter interface {
+	Moving() bool
+}
+
+// VelocityDriver is implemented by Drivers that can move each axis
+// continuously at a commanded rate, in degrees per second (positive is
+// clockwise/up). A rate of zero stops that axis.
+type VelocityDriver interface {
+	Driver
+	SetRate(az, el float64) error
+}
+
+// Homer is implemented by Drivers for positioners that lose their absolute
+// position (e.g. after a power cycle) and must be re-referenced by driving to
+// their limit or index switches. Home starts the reference search and should
+// return as soon as it is accepted; Referenced reports whether the position
+// is currently referenced (it is false until a reference search completes).
+type Homer interface {
+	Driver
+	Home() error
+	Referenced() bool
+}
+
+// FaultReporter is implemented by Drivers whose hardware reports faults of
+// its own (e.g. a PLC's fault bit). HardwareFault returns the fault seen by
+// the latest Position, or nil if there isn't one; a Rotor raises a
+// FaultHardware for it.
+type FaultReporter interface {
+	HardwareFault() error
+}
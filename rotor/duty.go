@@ -0,0 +1,163 @@
+package rotor
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// dutyMovement is the least an axis must move between position updates, in
+// degrees, to count as running when it isn't being driven toward a target
+const dutyMovement = 0.01
+
+// maxDutyStep caps the time counted for a single position update, so that a
+// gap in updates (e.g. while the Driver is disconnected) isn't counted as
+// running
+const maxDutyStep = time.Second
+
+// DutyCycleError is returned when an axis's motor has used up its duty cycle
+// budget, so it must rest before it can be run again
+type DutyCycleError struct {
+	Axis string `json:"axis"`
+	AxisDuty
+}
+
+func (e *DutyCycleError) Error() string {
+	return fmt.Sprintf("rotor: %v motor duty cycle exhausted (ran %.0fs of the %.0fs allowed in the last %.0fs)", e.Axis, e.UsedSeconds, e.AllowedSeconds, e.WindowSeconds)
+}
+
+// AxisDuty describes how much one axis's motor has run over the duty cycle
+// window
+type AxisDuty struct {
+	UsedSeconds      float64 `json:"used_seconds"`
+	AllowedSeconds   float64 `json:"allowed_seconds"`
+	RemainingSeconds float64 `json:"remaining_seconds"`
+	WindowSeconds    float64 `json:"window_seconds"`
+}
+
+// DutyStatus describes the duty cycle budget of both axes
+type DutyStatus struct {
+	// Cycle is the fraction of the window each motor may run for
+	Cycle float64  `json:"cycle"`
+	Az    AxisDuty `json:"azimuth"`
+	El    AxisDuty `json:"elevation"`
+}
+
+// dutyTracker records when each axis's motor runs, over a sliding window
+type dutyTracker struct {
+	mu      sync.Mutex
+	cycle   float64
+	window  time.Duration
+	az, el  []span
+	updated time.Time
+}
+
+// span is a period during which a motor ran
+type span struct {
+	start, end time.Time
+}
+
+// record counts the time since the previous update as running for each axis
+// that was running
+func (d *dutyTracker) record(azOn, elOn bool, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	start := d.updated
+	d.updated = now
+	if start.IsZero() || now.Sub(start) > maxDutyStep {
+		return
+	}
+	if azOn {
+		d.az = extend(d.az, start, now)
+	}
+	if elOn {
+		d.el = extend(d.el, start, now)
+	}
+	d.az = prune(d.az, now.Add(-d.window))
+	d.el = prune(d.el, now.Add(-d.window))
+}
+
+// status reports the budget of both axes
+func (d *dutyTracker) status(now time.Time) DutyStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return DutyStatus{Cycle: d.cycle, Az: d.axis(d.az, now), El: d.axis(d.el, now)}
+}
+
+// check returns a *DutyCycleError for the first of the given axes that has
+// no budget left
+func (d *dutyTracker) check(az, el bool) error {
+	if d.cycle <= 0 {
+		return nil
+	}
+	s := d.status(time.Now())
+	if az && s.Az.RemainingSeconds <= 0 {
+		return &DutyCycleError{Axis: "azimuth", AxisDuty: s.Az}
+	}
+	if el && s.El.RemainingSeconds <= 0 {
+		return &DutyCycleError{Axis: "elevation", AxisDuty: s.El}
+	}
+	return nil
+}
+
+func (d *dutyTracker) axis(spans []span, now time.Time) AxisDuty {
+	since := now.Add(-d.window)
+	var used time.Duration
+	for _, s := range spans {
+		start := s.start
+		if start.Before(since) {
+			start = since
+		}
+		if s.end.After(start) {
+			used += s.end.Sub(start)
+		}
+	}
+	allowed := d.cycle * d.window.Seconds()
+	return AxisDuty{
+		UsedSeconds:      used.Seconds(),
+		AllowedSeconds:   allowed,
+		RemainingSeconds: math.Max(0, allowed-used.Seconds()),
+		WindowSeconds:    d.window.Seconds(),
+	}
+}
+
+// extend adds a running period, merging it into the last one if they touch
+func extend(spans []span, start, end time.Time) []span {
+	if n := len(spans); n > 0 && !spans[n-1].end.Before(start) {
+		spans[n-1].end = end
+		return spans
+	}
+	return append(spans, span{start: start, end: end})
+}
+
+// prune drops running periods that ended before a time
+func prune(spans []span, before time.Time) []span {
+	i := 0
+	for i < len(spans) && spans[i].end.Before(before) {
+		i++
+	}
+	return spans[i:]
+}
+
+// Duty returns the duty cycle budget of both axes, or nil if the Rotor has
+// no duty cycle limit
+func (r *Rotor) Duty() *DutyStatus {
+	if r.duty.cycle <= 0 {
+		return nil
+	}
+	s := r.duty.status(time.Now())
+	return &s
+}
+
+// checkDutyPath returns a *DutyCycleError if following a path of mechanical
+// positions needs an axis whose duty cycle is exhausted
+func (r *Rotor) checkDutyPath(from State, path []State) error {
+	for _, to := range path {
+		if err := r.duty.check(math.Abs(to.Az-from.Az) > Tolerance, math.Abs(to.El-from.El) > Tolerance); err != nil {
+			return err
+		}
+		from = to
+	}
+	return nil
+}
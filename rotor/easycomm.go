@@ -0,0 +1,237 @@
+package rotor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EasyComm status bits reported by the GS command (EasyComm III only)
+const (
+	EasyCommIdle     = 1
+	EasyCommMoving   = 2
+	EasyCommPointing = 4
+	EasyCommError    = 8
+)
+
+var (
+	easyCommPosition = regexp.MustCompile(`AZ\s*([-+]?\d+(?:\.\d+)?)\s*EL\s*([-+]?\d+(?:\.\d+)?)`)
+	easyCommValue    = regexp.MustCompile(`^(GS|GE)\s*(\d+)`)
+)
+
+// ErrNotSupported is returned when a Driver is asked to do something its
+// hardware or protocol version cannot
+var ErrNotSupported = errors.New("rotor: not supported by this driver")
+
+// EasyComm is a Driver for controllers speaking the EasyComm I, II or III
+// text protocols, which are common on DIY (e.g. Arduino-based) rotators.
+// EasyComm I can only set a position, so it has no position feedback and
+// cannot stop; EasyComm III adds velocity and status commands. The status is
+// read along with each position, so that an EasyComm III controller reports
+// whether it is moving (see MotionReporter) and its alarms (see
+// FaultReporter).
+type EasyComm struct {
+	mu      sync.Mutex
+	link    *link
+	version int
+	target  State
+	// status and fault are from the latest Status
+	status int
+	fault  error
+}
+
+// NewEasyComm creates an EasyComm Driver speaking the given protocol version
+// (1, 2 or 3) to a controller over rw (usually a port opened with
+// OpenSerial). The timeout bounds how long to wait for the controller to
+// answer a query.
+func NewEasyComm(rw io.ReadWriteCloser, version int, timeout time.Duration) (*EasyComm, error) {
+	if version < 1 || version > 3 {
+		return nil, fmt.Errorf("easycomm: unknown protocol version %d", version)
+	}
+	return &EasyComm{link: newLink(rw, timeout), version: version}, nil
+}
+
+// SetTarget sends an "AZaaa.a ELeee.e" command
+func (e *EasyComm) SetTarget(s State) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	cmd := fmt.Sprintf("AZ%.1f EL%.1f", s.Az, s.El)
+	if e.version == 1 {
+		// EasyComm I always carries the uplink/downlink fields
+		cmd += " UP000 XXX DN000 XXX"
+	}
+	if err := e.send(cmd); err != nil {
+		return err
+	}
+	e.target = s
+	return nil
+}
+
+// Position sends an "AZ EL" query and parses the response, then (on EasyComm
+// III) reads the status. EasyComm I has no query, so the last commanded
+// position is reported instead.
+func (e *EasyComm) Position() (State, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.version == 1 {
+		return e.target, nil
+	}
+	e.link.flush()
+	if err := e.send("AZ EL"); err != nil {
+		return State{}, err
+	}
+	for {
+		line, err := e.readLine()
+		if err != nil {
+			return State{}, err
+		}
+		m := easyCommPosition.FindStringSubmatch(line)
+		if m == nil {
+			// an echo of the query or unrelated chatter
+			continue
+		}
+		az, _ := strconv.ParseFloat(m[1], 64)
+		el, _ := strconv.ParseFloat(m[2], 64)
+		if e.version > 2 {
+			if _, err := e.readStatus(); err != nil {
+				return State{}, err
+			}
+		}
+		return State{Az: az, El: el}, nil
+	}
+}
+
+// Stop sends an "SA SE" command
+func (e *EasyComm) Stop() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.version == 1 {
+		return ErrNotSupported
+	}
+	return e.send("SA SE")
+}
+
+// SetRate commands each axis to move continuously at a rate in degrees per
+// second (positive is clockwise/up) using the EasyComm III VL/VR/VU/VD
+// commands. A rate of zero stops that axis.
+func (e *EasyComm) SetRate(az, el float64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.version < 3 {
+		return ErrNotSupported
+	}
+	azCmd := "VR"
+	if az < 0 {
+		azCmd = "VL"
+	}
+	elCmd := "VU"
+	if el < 0 {
+		elCmd = "VD"
+	}
+	// velocities are sent in millidegrees per second
+	cmd := fmt.Sprintf("%v%d %v%d", azCmd, int(math.Round(math.Abs(az)*1000)), elCmd, int(math.Round(math.Abs(el)*1000)))
+	return e.send(cmd)
+}
+
+// Status sends a "GS" query and returns the controller's status bits (see
+// EasyCommIdle et al.). If the error bit is set, the error code is read with
+// a "GE" query and returned as an error.
+func (e *EasyComm) Status() (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.version < 3 {
+		return 0, ErrNotSupported
+	}
+	status, err := e.readStatus()
+	if err != nil {
+		return status, err
+	}
+	return status, e.fault
+}
+
+// Moving reports whether the moving bit was set in the latest status (always
+// false before EasyComm III)
+func (e *EasyComm) Moving() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status&EasyCommMoving != 0
+}
+
+// HardwareFault returns the error the controller reported in the latest
+// status, or nil if there wasn't one
+func (e *EasyComm) HardwareFault() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.fault
+}
+
+// Capabilities describes the EasyComm controller
+func (e *EasyComm) Capabilities() Capabilities {
+	return Capabilities{
+		Model:    fmt.Sprintf("EasyComm %v", strings.Repeat("I", e.version)),
+		Feedback: e.version > 1,
+		Velocity: e.version > 2,
+		Stop:     e.version > 1,
+	}
+}
+
+// Close closes the serial connection
+func (e *EasyComm) Close() error {
+	return e.link.close()
+}
+
+func (e *EasyComm) send(cmd string) error {
+	return e.link.write([]byte(cmd + "\n"))
+}
+
+func (e *EasyComm) readLine() (string, error) {
+	line, err := e.link.readUntil('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+// readStatus queries the status bits, and the error code if the error bit is
+// set, recording them for Moving and HardwareFault
+func (e *EasyComm) readStatus() (int, error) {
+	status, err := e.query("GS")
+	if err != nil {
+		return 0, err
+	}
+	e.status, e.fault = status, nil
+	if status&EasyCommError != 0 {
+		code, err := e.query("GE")
+		if err != nil {
+			return status, err
+		}
+		e.fault = fmt.Errorf("easycomm: controller reports error %d", code)
+	}
+	return status, nil
+}
+
+// query sends a GS or GE command and parses the numeric value from its
+// response
+func (e *EasyComm) query(cmd string) (int, error) {
+	e.link.flush()
+	if err := e.send(cmd); err != nil {
+		return 0, err
+	}
+	for {
+		line, err := e.readLine()
+		if err != nil {
+			return 0, err
+		}
+		m := easyCommValue.FindStringSubmatch(line)
+		if m == nil || m[1] != cmd {
+			continue
+		}
+		return strconv.Atoi(m[2])
+	}
+}
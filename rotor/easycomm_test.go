@@ -0,0 +1,150 @@
+package rotor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFakeEasyComm starts a fakeController playing an EasyComm controller and
+// returns it along with an EasyComm Driver speaking the given version to it
+func newFakeEasyComm(t *testing.T, version int, reply func(cmd string) string) (*fakeController, *EasyComm) {
+	f, port := newFakeController(t, '\n', reply)
+	e, err := NewEasyComm(port, version, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, e
+}
+
+func TestEasyCommPosition(t *testing.T) {
+	for _, tc := range []struct {
+		name, reply string
+		want        State
+	}{
+		{"plain", "AZ123.4 EL45.6\n", State{Az: 123.4, El: 45.6}},
+		{"spaced", "AZ 7 EL -1.5\r\n", State{Az: 7, El: -1.5}},
+		{"echoed", "AZ EL\nAZ10.0 EL90.0\n", State{Az: 10, El: 90}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, e := newFakeEasyComm(t, 2, func(string) string { return tc.reply })
+			pos, err := e.Position()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pos != tc.want {
+				t.Errorf("position %v, want %v", pos, tc.want)
+			}
+			if got := f.last(); got != "AZ EL\n" {
+				t.Errorf("sent %q", got)
+			}
+		})
+	}
+}
+
+func TestEasyCommTimeout(t *testing.T) {
+	_, e := newFakeEasyComm(t, 2, func(string) string { return "" })
+	if _, err := e.Position(); err != ErrResponseTimeout {
+		t.Errorf("got %v from a silent controller, want ErrResponseTimeout", err)
+	}
+}
+
+func TestEasyCommI(t *testing.T) {
+	f, e := newFakeEasyComm(t, 1, func(string) string { return "" })
+	if e.Capabilities().Feedback {
+		t.Error("EasyComm I claims position feedback")
+	}
+	if err := e.SetTarget(State{Az: 180, El: 12.34}); err != nil {
+		t.Fatal(err)
+	}
+	f.await(t, "AZ180.0 EL12.3 UP000 XXX DN000 XXX\n")
+	pos, err := e.Position()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != (State{Az: 180, El: 12.34}) {
+		t.Errorf("position %v, want the last target", pos)
+	}
+	if err := e.Stop(); err != ErrNotSupported {
+		t.Errorf("got %v from Stop, want ErrNotSupported", err)
+	}
+
+	r, err := New(e, Config{Limits: DefaultLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.EmergencyStop(); err != ErrNotSupported {
+		t.Errorf("got %v from EmergencyStop, want ErrNotSupported", err)
+	}
+	if s := r.Status(); !s.EmergencyStop || s.Stoppable {
+		t.Errorf("emergency stop %v, stoppable %v: want latched but not stoppable", s.EmergencyStop, s.Stoppable)
+	}
+}
+
+func TestEasyCommIII(t *testing.T) {
+	f, e := newFakeEasyComm(t, 3, func(string) string { return "" })
+	if !e.Capabilities().Velocity {
+		t.Error("EasyComm III can't move at a rate")
+	}
+	if err := e.SetRate(-1.5, 0.25); err != nil {
+		t.Fatal(err)
+	}
+	f.await(t, "VL1500 VU250\n")
+	if err := e.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	f.await(t, "SA SE\n")
+
+	_, e = newFakeEasyComm(t, 2, func(string) string { return "" })
+	if err := e.SetRate(1, 1); err != ErrNotSupported {
+		t.Errorf("got %v from EasyComm II SetRate, want ErrNotSupported", err)
+	}
+}
+
+func TestEasyCommStatus(t *testing.T) {
+	var status int32 = EasyCommMoving
+	_, e := newFakeEasyComm(t, 3, func(cmd string) string {
+		switch strings.TrimSpace(cmd) {
+		case "AZ EL":
+			return "AZ10.0 EL20.0\n"
+		case "GS":
+			return fmt.Sprintf("GS%d\n", atomic.LoadInt32(&status))
+		case "GE":
+			return "GE4\n"
+		}
+		return ""
+	})
+	if _, err := e.Position(); err != nil {
+		t.Fatal(err)
+	}
+	if !e.Moving() || e.HardwareFault() != nil {
+		t.Errorf("moving %v, fault %v: want moving without a fault", e.Moving(), e.HardwareFault())
+	}
+
+	atomic.StoreInt32(&status, EasyCommIdle)
+	r, err := New(e, Config{Limits: DefaultLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * pollInterval)
+	if e.Moving() {
+		t.Error("moving once the controller is idle")
+	}
+	atomic.StoreInt32(&status, EasyCommError)
+	deadline := time.Now().Add(time.Second)
+	for r.Fault() == nil && time.Now().Before(deadline) {
+		time.Sleep(pollInterval)
+	}
+	if f := r.Fault(); f == nil || f.Code != FaultHardware || !strings.Contains(f.Message, "error 4") {
+		t.Fatalf("got fault %v, want a hardware fault for error 4", f)
+	}
+	if err := r.Rotate(context.Background(), State{Az: 30, El: 30}, ControllerManual); err != ErrFaulted {
+		t.Errorf("got %v after the alarm, want ErrFaulted", err)
+	}
+	if _, err := e.Status(); err == nil {
+		t.Error("Status didn't return the alarm")
+	}
+}
@@ -0,0 +1,204 @@
+package rotor
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// Fault codes
+const (
+	// FaultStall is raised when the position stops changing partway through
+	// a move (e.g. a jammed rotator)
+	FaultStall = "stall"
+	// FaultDivergence is raised when the position moves away from the target
+	// (e.g. a reversed motor or a failed position sensor)
+	FaultDivergence = "divergence"
+	// FaultHardware is raised when the Driver reports a fault in the
+	// hardware itself (see FaultReporter)
+	FaultHardware = "hardware"
+)
+
+// stallMovement is the least an axis must move, in degrees, to count as
+// progress
+const stallMovement = 0.1
+
+// Fault describes a problem detected in the rotor's position feedback while
+// it was moving. A Fault stops the rotor and is latched (like an emergency
+// stop) until it is reset.
+type Fault struct {
+	Code     string    `json:"code"`
+	Message  string    `json:"message"`
+	Position State     `json:"position"`
+	Target   State     `json:"target"`
+	Time     time.Time `json:"time"`
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("rotor: %v fault: %v", f.Code, f.Message)
+}
+
+// Fault returns the latched Fault, or nil if there isn't one
+func (r *Rotor) Fault() *Fault {
+	return r.fault.Load().(*Fault)
+}
+
+// ResetFault releases a latched Fault so that the Rotor accepts commands
+// again
+func (r *Rotor) ResetFault() {
+	r.fault.Store((*Fault)(nil))
+}
+
+// Blocked returns the reason the Rotor is refusing commands (ErrEmergencyStop,
+// ErrFaulted or ErrUnreferenced), or nil if it isn't
+func (r *Rotor) Blocked() error {
+	if r.EmergencyStopped() {
+		return ErrEmergencyStop
+	}
+	if r.Fault() != nil {
+		return ErrFaulted
+	}
+	if !r.Referenced() {
+		return ErrUnreferenced
+	}
+	return nil
+}
+
+// checkFeedback watches the position during a move, returning a Fault if it
+// hasn't changed within the Config's StallWindow or has moved more than its
+// DivergenceLimit further from the target than it has been. Drivers without
+// position feedback aren't checked.
+func (r *Rotor) checkFeedback(m *move, pos State) *Fault {
+	if !r.driver.Capabilities().Feedback {
+		return nil
+	}
+	now := time.Now()
+	fault := &Fault{Position: pos, Target: m.target, Time: now}
+	if math.Abs(pos.Az-m.progressPos.Az) >= stallMovement || math.Abs(pos.El-m.progressPos.El) >= stallMovement {
+		m.progressPos, m.progressAt = pos, now
+	} else if r.config.StallWindow > 0 && now.Sub(m.progressAt) > r.config.StallWindow {
+		fault.Code = FaultStall
+		fault.Message = fmt.Sprintf("position hasn't changed in %v", r.config.StallWindow)
+		return fault
+	}
+
+	d := distance(pos, m.target)
+	if d < m.closest {
+		m.closest = d
+	} else if r.config.DivergenceLimit > 0 && d > m.closest+r.config.DivergenceLimit {
+		fault.Code = FaultDivergence
+		fault.Message = fmt.Sprintf("position is moving away from the target (%.1f degrees off, was %.1f)", d, m.closest)
+		return fault
+	}
+	return nil
+}
+
+// rateProgress is the progress checkRate has seen the rotor make while
+// moving at a rate. origin is where the current direction of travel was
+// first commanded, and furthest is how far each axis has since got from it
+// in that direction.
+type rateProgress struct {
+	origin      State
+	furthest    State
+	progressPos State
+	progressAt  time.Time
+}
+
+// newRateProgress starts watching a rate command from pos
+func newRateProgress(pos State) rateProgress {
+	return rateProgress{origin: pos, progressPos: pos, progressAt: time.Now()}
+}
+
+// sameDirection reports whether two rates drive each axis the same way (or
+// leave it still)
+func sameDirection(a, b Velocity) bool {
+	sign := func(x float64) int {
+		switch {
+		case x > 0:
+			return 1
+		case x < 0:
+			return -1
+		}
+		return 0
+	}
+	return sign(a.Az) == sign(b.Az) && sign(a.El) == sign(b.El)
+}
+
+// checkRate watches the position while moving at rate v, returning a Fault
+// if it hasn't changed within the Config's StallWindow even though v should
+// have moved it, or has moved more than its DivergenceLimit back against the
+// commanded direction. Drivers without position feedback aren't checked.
+func (r *Rotor) checkRate(p *rateProgress, v Velocity, pos State) *Fault {
+	if !r.driver.Capabilities().Feedback {
+		return nil
+	}
+	now := time.Now()
+	fault := &Fault{Position: pos, Time: now}
+	window := r.config.StallWindow
+	// an axis commanded too slowly to visibly move within the window can't
+	// be told apart from a stalled one
+	expected := math.Max(math.Abs(v.Az), math.Abs(v.El)) * window.Seconds()
+	if math.Abs(pos.Az-p.progressPos.Az) >= stallMovement || math.Abs(pos.El-p.progressPos.El) >= stallMovement {
+		p.progressPos, p.progressAt = pos, now
+	} else if window > 0 && expected >= 2*stallMovement && now.Sub(p.progressAt) > window {
+		fault.Code = FaultStall
+		fault.Message = fmt.Sprintf("position hasn't changed in %v while moving at %.2f,%.2f deg/s", window, v.Az, v.El)
+		return fault
+	}
+
+	// progress along the commanded direction of each axis
+	az := math.Copysign(1, v.Az) * (pos.Az - p.origin.Az)
+	el := math.Copysign(1, v.El) * (pos.El - p.origin.El)
+	p.furthest.Az, p.furthest.El = math.Max(p.furthest.Az, az), math.Max(p.furthest.El, el)
+	limit := r.config.DivergenceLimit
+	if limit <= 0 {
+		return nil
+	}
+	if v.Az != 0 && p.furthest.Az-az > limit {
+		fault.Code = FaultDivergence
+		fault.Message = fmt.Sprintf("azimuth is moving against the commanded rate (%.1f degrees back)", p.furthest.Az-az)
+		return fault
+	}
+	if v.El != 0 && p.furthest.El-el > limit {
+		fault.Code = FaultDivergence
+		fault.Message = fmt.Sprintf("elevation is moving against the commanded rate (%.1f degrees back)", p.furthest.El-el)
+		return fault
+	}
+	return nil
+}
+
+// hardwareFault returns a Fault if the Driver reports a hardware fault that
+// hasn't already been latched
+func (r *Rotor) hardwareFault(m *move, pos State) *Fault {
+	fr, ok := r.driver.(FaultReporter)
+	if !ok || r.Fault() != nil {
+		return nil
+	}
+	err := fr.HardwareFault()
+	if err == nil {
+		return nil
+	}
+	f := &Fault{Code: FaultHardware, Message: err.Error(), Position: pos, Time: time.Now()}
+	if m != nil {
+		f.Target = m.target
+	}
+	return f
+}
+
+// raise stops the Driver and latches a Fault, notifying the Config's OnFault
+// callback
+func (r *Rotor) raise(f *Fault) {
+	if err := r.driver.Stop(); err != nil {
+		log.Printf("rotor: failed to stop after %v fault: %v", f.Code, err)
+	}
+	r.fault.Store(f)
+	if r.config.OnFault != nil {
+		go r.config.OnFault(*f)
+	}
+}
+
+// distance is how far apart two positions are on the furthest axis
+func distance(a, b State) float64 {
+	return math.Max(math.Abs(a.Az-b.Az), math.Abs(a.El-b.El))
+}
@@ -0,0 +1,116 @@
+package rotor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// brokenDriver is a Simulator whose motors ignore commands (jammed) or run
+// them backwards (reversed)
+type brokenDriver struct {
+	*Simulator
+	jammed, reversed bool
+}
+
+func (d *brokenDriver) SetRate(az, el float64) error {
+	if d.jammed {
+		return nil
+	}
+	if d.reversed {
+		az, el = -az, -el
+	}
+	return d.Simulator.SetRate(az, el)
+}
+
+func (d *brokenDriver) SetTarget(target State) error {
+	if d.jammed {
+		return nil
+	}
+	if d.reversed {
+		pos, _ := d.Simulator.Position()
+		target = State{Az: 2*pos.Az - target.Az, El: 2*pos.El - target.El}
+	}
+	return d.Simulator.SetTarget(target)
+}
+
+func TestMoveFaults(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		driver brokenDriver
+		want   string
+	}{
+		{"healthy", brokenDriver{}, ""},
+		{"jammed", brokenDriver{jammed: true}, FaultStall},
+		{"reversed", brokenDriver{reversed: true}, FaultDivergence},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := tc.driver
+			d.Simulator = NewSimulator(State{Az: 100, El: 20}, SimulatorConfig{MaxRate: 20})
+			r, err := New(&d, Config{Limits: DefaultLimits, StallWindow: 300 * time.Millisecond, DivergenceLimit: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+			err = r.Rotate(ctx, State{Az: 130, El: 30}, ControllerManual)
+			got := ""
+			if f := r.Fault(); f != nil {
+				got = f.Code
+			}
+			if got != tc.want {
+				t.Errorf("got fault %q, want %q", got, tc.want)
+			}
+			if tc.want == "" {
+				if err != nil {
+					t.Errorf("got %v from a healthy move", err)
+				}
+				return
+			}
+			if f, ok := err.(*Fault); !ok || f.Code != tc.want {
+				t.Errorf("got %v from the move, want the %q fault", err, tc.want)
+			}
+			if d.Moving() {
+				t.Error("still moving after the fault")
+			}
+		})
+	}
+}
+
+func TestRateFaults(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		driver brokenDriver
+		want   string
+	}{
+		{"healthy", brokenDriver{}, ""},
+		{"jammed", brokenDriver{jammed: true}, FaultStall},
+		{"reversed", brokenDriver{reversed: true}, FaultDivergence},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := tc.driver
+			d.Simulator = NewSimulator(State{Az: 100, El: 20}, SimulatorConfig{MaxRate: 20})
+			r, err := New(&d, Config{Limits: DefaultLimits, StallWindow: 300 * time.Millisecond, DivergenceLimit: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := r.SetRate(context.Background(), Velocity{Az: 10, El: 5}, ControllerManual); err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(time.Second)
+			for r.Fault() == nil && time.Now().Before(deadline) {
+				time.Sleep(pollInterval)
+			}
+			got := ""
+			if f := r.Fault(); f != nil {
+				got = f.Code
+			}
+			if got != tc.want {
+				t.Errorf("got fault %q, want %q", got, tc.want)
+			}
+			if tc.want != "" && d.Moving() {
+				t.Error("still moving after the fault")
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package rotor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// gs232Number matches the numeric fields of a C2 response in either the
+// GS-232A ("+0123+0045") or GS-232B ("AZ=123  EL=045") format
+var gs232Number = regexp.MustCompile(`[+-]?\d+`)
+
+// GS232 is a Driver for Yaesu GS-232A/B rotator controllers (e.g. in front of
+// a G-5500) connected over a serial line
+type GS232 struct {
+	mu   sync.Mutex
+	link *link
+}
+
+// NewGS232 creates a GS232 Driver that talks to a controller over rw (usually
+// a port opened with OpenSerial). The timeout bounds how long to wait for the
+// controller to answer a position query.
+func NewGS232(rw io.ReadWriteCloser, timeout time.Duration) *GS232 {
+	return &GS232{link: newLink(rw, timeout)}
+}
+
+// SetTarget sends a "Waaa eee" command. The controller only accepts whole
+// degrees, so the target is rounded.
+func (g *GS232) SetTarget(s State) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cmd := fmt.Sprintf("W%03d %03d\r", int(math.Round(s.Az)), int(math.Round(s.El)))
+	return g.link.write([]byte(cmd))
+}
+
+// Position sends a "C2" command and parses the azimuth and elevation from the
+// response. Echoed commands and blank lines are skipped.
+func (g *GS232) Position() (State, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.link.flush()
+	if err := g.link.write([]byte("C2\r")); err != nil {
+		return State{}, err
+	}
+	for {
+		line, err := g.link.readUntil('\r')
+		if err != nil {
+			return State{}, err
+		}
+		line = bytes.TrimSpace(line)
+		if bytes.HasPrefix(line, []byte("?>")) {
+			return State{}, fmt.Errorf("gs232: command rejected: %q", line)
+		}
+		if s, ok := parseGS232Position(line); ok {
+			return s, nil
+		}
+	}
+}
+
+// Stop sends an "S" command (all stop)
+func (g *GS232) Stop() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.link.write([]byte("S\r"))
+}
+
+// Capabilities describes the GS-232 controller
+func (g *GS232) Capabilities() Capabilities {
+	return Capabilities{Model: "Yaesu GS-232", Feedback: true, Stop: true}
+}
+
+// Close closes the serial connection
+func (g *GS232) Close() error {
+	return g.link.close()
+}
+
+func parseGS232Position(line []byte) (State, bool) {
+	if !bytes.HasPrefix(line, []byte("AZ=")) && !bytes.HasPrefix(line, []byte("+")) {
+		return State{}, false
+	}
+	fields := gs232Number.FindAll(line, -1)
+	if len(fields) != 2 {
+		return State{}, false
+	}
+	az, err := strconv.Atoi(string(fields[0]))
+	if err != nil {
+		return State{}, false
+	}
+	el, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return State{}, false
+	}
+	return State{Az: float64(az), El: float64(el)}, true
+}
@@ -0,0 +1,71 @@
+package rotor
+
+import (
+	"testing"
+	"time"
+)
+
+// newFakeGS232 starts a fakeController playing a GS-232 and returns it along
+// with a GS232 Driver talking to it
+func newFakeGS232(t *testing.T, reply func(cmd string) string) (*fakeController, *GS232) {
+	f, port := newFakeController(t, '\r', reply)
+	return f, NewGS232(port, 200*time.Millisecond)
+}
+
+func TestGS232Position(t *testing.T) {
+	for _, tc := range []struct {
+		name, reply string
+		want        State
+	}{
+		{"GS-232A", "+0123+0045\r", State{Az: 123, El: 45}},
+		{"GS-232B", "AZ=359  EL=000\r", State{Az: 359, El: 0}},
+		{"echoed", "C2\r\r\nAZ=010  EL=090\r", State{Az: 10, El: 90}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, g := newFakeGS232(t, func(string) string { return tc.reply })
+			pos, err := g.Position()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pos != tc.want {
+				t.Errorf("position %v, want %v", pos, tc.want)
+			}
+		})
+	}
+}
+
+func TestGS232Errors(t *testing.T) {
+	_, g := newFakeGS232(t, func(string) string { return "?>\r" })
+	if _, err := g.Position(); err == nil {
+		t.Error("a rejected C2 returned a position")
+	}
+
+	_, g = newFakeGS232(t, func(string) string { return "" })
+	start := time.Now()
+	if _, err := g.Position(); err != ErrResponseTimeout {
+		t.Errorf("got %v from a silent controller, want ErrResponseTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out after %v, want 200ms", elapsed)
+	}
+}
+
+func TestGS232Commands(t *testing.T) {
+	f, g := newFakeGS232(t, func(string) string { return "" })
+	if err := g.SetTarget(State{Az: 7.6, El: 44.4}); err != nil {
+		t.Fatal(err)
+	}
+	f.await(t, "W008 044\r")
+	if err := g.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	f.await(t, "S\r")
+}
+
+func TestParseGS232Position(t *testing.T) {
+	for _, line := range []string{"", "C2", "AZ=123", "+0123", "?>", "AZ=1 EL=2 X=3"} {
+		if s, ok := parseGS232Position([]byte(line)); ok {
+			t.Errorf("%q parsed as %v", line, s)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package rotor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Lease grants one controller exclusive control of the Rotor until it
+// expires. While a Lease is held, commands from any other Controller are
+// rejected with a *LeaseError (stopping the rotor is always allowed).
+type Lease struct {
+	// Holder names who holds the Lease (e.g. an operator, or "executor")
+	Holder     string     `json:"holder"`
+	Controller Controller `json:"controller"`
+	Expires    time.Time  `json:"expires"`
+}
+
+// LeaseError is returned when a command or Lease request conflicts with a
+// Lease held by someone else
+type LeaseError struct {
+	Lease
+}
+
+func (e *LeaseError) Error() string {
+	return fmt.Sprintf("rotor: %v (%v) holds the control lease until %v", e.Holder, e.Controller, e.Expires.Format(time.RFC3339))
+}
+
+// Lease returns the current Lease, or false if no unexpired Lease is held
+func (r *Rotor) Lease() (Lease, bool) {
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+	return r.currentLease()
+}
+
+// AcquireLease grants holder control of the Rotor (as the given Controller)
+// for ttl, or renews its Lease if it already holds it. A Lease held by anyone
+// else is refused with a *LeaseError, unless force is set, in which case it
+// is taken over.
+func (r *Rotor) AcquireLease(holder string, by Controller, ttl time.Duration, force bool) (Lease, error) {
+	if holder == "" {
+		return Lease{}, errors.New("rotor: a lease must name its holder")
+	}
+	if ttl <= 0 {
+		return Lease{}, errors.New("rotor: a lease must last for a positive duration")
+	}
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+	if l, ok := r.currentLease(); ok && l.Holder != holder && !force {
+		return Lease{}, &LeaseError{l}
+	}
+	r.lease = &Lease{Holder: holder, Controller: by, Expires: time.Now().Add(ttl)}
+	return *r.lease, nil
+}
+
+// ReleaseLease gives up holder's Lease. It is refused with a *LeaseError if
+// someone else holds the Lease.
+func (r *Rotor) ReleaseLease(holder string) error {
+	r.leaseMu.Lock()
+	defer r.leaseMu.Unlock()
+	l, ok := r.currentLease()
+	if !ok {
+		return nil
+	}
+	if l.Holder != holder {
+		return &LeaseError{l}
+	}
+	r.lease = nil
+	return nil
+}
+
+// checkLease returns a *LeaseError if a Controller other than by holds the
+// Lease
+func (r *Rotor) checkLease(by Controller) error {
+	if l, ok := r.Lease(); ok && l.Controller != by {
+		return &LeaseError{l}
+	}
+	return nil
+}
+
+// currentLease returns the Lease if it hasn't expired. leaseMu must be held.
+func (r *Rotor) currentLease() (Lease, bool) {
+	if r.lease == nil || time.Now().After(r.lease.Expires) {
+		return Lease{}, false
+	}
+	return *r.lease, true
+}
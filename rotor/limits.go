@@ -0,0 +1,56 @@
+package rotor
+
+import "fmt"
+
+// DefaultLimits allow a full turn of azimuth and horizon-to-zenith elevation
+var DefaultLimits = Limits{MinAz: 0, MaxAz: 360, MinEl: 0, MaxEl: 90}
+
+// Limits are the mechanical soft limits of a rotor, in degrees. The azimuth
+// limits describe the rotor's mechanical travel, which may span more than a
+// full turn (e.g. 0-450) for rotors with a cable wrap.
+type Limits struct {
+	MinAz float64 `json:"min_azimuth"`
+	MaxAz float64 `json:"max_azimuth"`
+	MinEl float64 `json:"min_elevation"`
+	MaxEl float64 `json:"max_elevation"`
+}
+
+// LimitError describes a State that falls outside of a rotor's Limits
+type LimitError struct {
+	Axis  string  `json:"axis"`
+	Value float64 `json:"value"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("rotor: %v %v is outside of the limits [%v, %v]", e.Axis, e.Value, e.Min, e.Max)
+}
+
+// Validate returns a *LimitError if a State cannot be reached within the
+// Limits. The azimuth of a State is a compass bearing, so it must be within
+// 0-360 and have an equivalent mechanical azimuth within the Limits.
+func (l Limits) Validate(s State) error {
+	if s.Az < 0 || s.Az > 360 {
+		return &LimitError{Axis: "azimuth", Value: s.Az, Min: 0, Max: 360}
+	}
+	if _, ok := l.Unwrap(s.Az, l.MinAz); !ok {
+		return &LimitError{Axis: "azimuth", Value: s.Az, Min: l.MinAz, Max: l.MaxAz}
+	}
+	if s.El < l.MinEl || s.El > l.MaxEl {
+		return &LimitError{Axis: "elevation", Value: s.El, Min: l.MinEl, Max: l.MaxEl}
+	}
+	return nil
+}
+
+// ValidateMechanical returns a *LimitError if a mechanical position (with an
+// unwrapped azimuth) falls outside of the Limits
+func (l Limits) ValidateMechanical(s State) error {
+	if s.Az < l.MinAz || s.Az > l.MaxAz {
+		return &LimitError{Axis: "azimuth", Value: s.Az, Min: l.MinAz, Max: l.MaxAz}
+	}
+	if s.El < l.MinEl || s.El > l.MaxEl {
+		return &LimitError{Axis: "elevation", Value: s.El, Min: l.MinEl, Max: l.MaxEl}
+	}
+	return nil
+}
@@ -0,0 +1,480 @@
+package rotor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Command codes written to a Modbus positioner's command register
+const (
+	ModbusCommandMove = 1
+	ModbusCommandStop = 2
+	ModbusCommandHome = 3
+)
+
+// Modbus function codes
+const (
+	modbusReadHoldingRegisters   = 0x03
+	modbusWriteMultipleRegisters = 0x10
+)
+
+// modbusExceptions maps Modbus exception codes to descriptions
+var modbusExceptions = map[byte]string{
+	1:  "illegal function",
+	2:  "illegal data address",
+	3:  "illegal data value",
+	4:  "server device failure",
+	5:  "acknowledge",
+	6:  "server device busy",
+	10: "gateway path unavailable",
+	11: "gateway target device failed to respond",
+}
+
+// ErrModbusFault is reported by HardwareFault while a Modbus positioner's
+// status register has its fault bit set
+var ErrModbusFault = errors.New("modbus: positioner reports a fault")
+
+// ModbusError is returned when a Modbus server answers a request with an
+// exception
+type ModbusError struct {
+	Function byte
+	Code     byte
+}
+
+func (e ModbusError) Error() string {
+	if desc, ok := modbusExceptions[e.Code]; ok {
+		return fmt.Sprintf("modbus: function %#02x failed with exception %d (%v)", e.Function, e.Code, desc)
+	}
+	return fmt.Sprintf("modbus: function %#02x failed with exception %d", e.Function, e.Code)
+}
+
+// ModbusMap describes where a positioner's PLC keeps its holding registers and
+// how their values are encoded. Positions are signed integers in units of
+// 1/Scale degrees, taking up Words registers each (1 for 16-bit values, 2 for
+// 32-bit values with the high word first). Status bits are numbered from the
+// least significant bit, and a negative bit means the PLC doesn't report it.
+type ModbusMap struct {
+	TargetAz uint16 `json:"target_az"`
+	TargetEl uint16 `json:"target_el"`
+	// Command is written with ModbusCommandMove, ModbusCommandStop or
+	// ModbusCommandHome
+	Command  uint16  `json:"command"`
+	ActualAz uint16  `json:"actual_az"`
+	ActualEl uint16  `json:"actual_el"`
+	Status   uint16  `json:"status"`
+	Scale    float64 `json:"scale"`
+	Words    int     `json:"words"`
+	// MovingBit is set while the positioner is moving
+	MovingBit int `json:"moving_bit"`
+	// FaultBit is set while the positioner has a fault
+	FaultBit int `json:"fault_bit"`
+	// ReferencedBit is set once the positioner has been homed (if it is
+	// reported, the positioner must be homed after a power cycle)
+	ReferencedBit int `json:"referenced_bit"`
+}
+
+// DefaultModbusMap returns the register map that ParseModbusMap starts from
+func DefaultModbusMap() ModbusMap {
+	return ModbusMap{
+		TargetAz:      0,
+		TargetEl:      2,
+		Command:       4,
+		ActualAz:      10,
+		ActualEl:      12,
+		Status:        14,
+		Scale:         100,
+		Words:         2,
+		MovingBit:     0,
+		FaultBit:      1,
+		ReferencedBit: -1,
+	}
+}
+
+// ParseModbusMap parses a comma-separated list of key=value pairs (e.g.
+// "target_az=100,target_el=102,scale=10,words=1"), with the keys named as in
+// the JSON form of a ModbusMap, over the DefaultModbusMap. This is how the
+// register map is configured. The map is checked by Validate when the Modbus
+// Driver is created.
+func ParseModbusMap(str string) (ModbusMap, error) {
+	m := DefaultModbusMap()
+	registers := map[string]*uint16{
+		"target_az": &m.TargetAz,
+		"target_el": &m.TargetEl,
+		"command":   &m.Command,
+		"actual_az": &m.ActualAz,
+		"actual_el": &m.ActualEl,
+		"status":    &m.Status,
+	}
+	ints := map[string]*int{
+		"words":          &m.Words,
+		"moving_bit":     &m.MovingBit,
+		"fault_bit":      &m.FaultBit,
+		"referenced_bit": &m.ReferencedBit,
+	}
+	for _, field := range strings.Split(str, ",") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return ModbusMap{}, fmt.Errorf("modbus: %q is not in key=value form", field)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		var err error
+		if p, ok := registers[key]; ok {
+			var v uint64
+			v, err = strconv.ParseUint(value, 10, 16)
+			*p = uint16(v)
+		} else if p, ok := ints[key]; ok {
+			*p, err = strconv.Atoi(value)
+		} else if key == "scale" {
+			m.Scale, err = strconv.ParseFloat(value, 64)
+		} else {
+			return ModbusMap{}, fmt.Errorf("modbus: unknown register map key %q", key)
+		}
+		if err != nil {
+			return ModbusMap{}, fmt.Errorf("modbus: invalid %v %q", key, value)
+		}
+	}
+	return m, nil
+}
+
+// Validate checks that a ModbusMap can be used for a positioner with the
+// given Limits (its hardware travel): in particular, that its scale and word
+// size can represent every position within them
+func (m ModbusMap) Validate(l Limits) error {
+	if m.Scale <= 0 {
+		return errors.New("modbus: scale must be positive")
+	}
+	if m.Words != 1 && m.Words != 2 {
+		return errors.New("modbus: values must take up 1 or 2 words")
+	}
+	for _, bit := range []int{m.MovingBit, m.FaultBit, m.ReferencedBit} {
+		if bit > 15 {
+			return fmt.Errorf("modbus: status bit %d is out of range", bit)
+		}
+	}
+	for _, deg := range []float64{l.MinAz, l.MaxAz, l.MinEl, l.MaxEl} {
+		if _, err := m.encode(deg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encode converts degrees into register values, returning an error if they
+// can't be represented
+func (m ModbusMap) encode(deg float64) ([]uint16, error) {
+	v := math.Round(deg * m.Scale)
+	min, max := float64(math.MinInt32), float64(math.MaxInt32)
+	if m.Words == 1 {
+		min, max = math.MinInt16, math.MaxInt16
+	}
+	if v < min || v > max || math.IsNaN(v) {
+		return nil, fmt.Errorf("modbus: %v degrees can't be represented at a scale of %v in %d-word registers", deg, m.Scale, m.Words)
+	}
+	if m.Words == 1 {
+		return []uint16{uint16(int16(v))}, nil
+	}
+	return []uint16{uint16(uint32(int32(v)) >> 16), uint16(int32(v))}, nil
+}
+
+// decode converts register values into degrees
+func (m ModbusMap) decode(regs []uint16) float64 {
+	if m.Words == 1 {
+		return float64(int16(regs[0])) / m.Scale
+	}
+	return float64(int32(uint32(regs[0])<<16|uint32(regs[1]))) / m.Scale
+}
+
+// bit reports whether a status bit is set (false if the PLC doesn't report
+// it)
+func (m ModbusMap) bit(status uint16, bit int) bool {
+	return bit >= 0 && status&(1<<uint(bit)) != 0
+}
+
+// Modbus is a Driver for PLC-based positioners controlled over Modbus TCP. A
+// target is written to the target registers followed by ModbusCommandMove to
+// the command register, and the position and status are read back from the
+// actual and status registers (see ModbusMap). The connection is
+// re-established automatically if it is lost.
+type Modbus struct {
+	mu          sync.Mutex
+	address     string
+	unit        byte
+	registerMap ModbusMap
+	timeout     time.Duration
+	conn        net.Conn
+	transaction uint16
+	referenced  bool
+	fault       bool
+}
+
+// NewModbus connects to the Modbus TCP server (in host:port form) of a
+// positioner with the given unit ID and register map. The register map must be
+// able to represent every position within the positioner's Limits. The
+// timeout bounds how long any single request may take.
+func NewModbus(address string, unit byte, m ModbusMap, l Limits, timeout time.Duration) (*Modbus, error) {
+	if err := m.Validate(l); err != nil {
+		return nil, err
+	}
+	d := &Modbus{address: address, unit: unit, registerMap: m, timeout: timeout}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.connect(); err != nil {
+		return nil, err
+	}
+	status, err := d.status()
+	if err != nil {
+		return nil, err
+	}
+	d.referenced = m.ReferencedBit < 0 || m.bit(status, m.ReferencedBit)
+	return d, nil
+}
+
+// SetTarget writes the target registers and then ModbusCommandMove
+func (d *Modbus) SetTarget(s State) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m := d.registerMap
+	az, err := m.encode(s.Az)
+	if err != nil {
+		return err
+	}
+	el, err := m.encode(s.El)
+	if err != nil {
+		return err
+	}
+	if err := d.writeRegisters(m.TargetAz, az); err != nil {
+		return err
+	}
+	if err := d.writeRegisters(m.TargetEl, el); err != nil {
+		return err
+	}
+	return d.writeRegisters(m.Command, []uint16{ModbusCommandMove})
+}
+
+// Position reads the actual registers, along with the status register's fault
+// bit (see HardwareFault)
+func (d *Modbus) Position() (State, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m := d.registerMap
+	status, err := d.status()
+	if err != nil {
+		return State{}, err
+	}
+	d.fault = m.bit(status, m.FaultBit)
+	az, err := d.readRegisters(m.ActualAz, m.Words)
+	if err != nil {
+		return State{}, err
+	}
+	el, err := d.readRegisters(m.ActualEl, m.Words)
+	if err != nil {
+		return State{}, err
+	}
+	return State{Az: m.decode(az), El: m.decode(el)}, nil
+}
+
+// HardwareFault returns ErrModbusFault if the status register's fault bit was
+// set when the position was last read
+func (d *Modbus) HardwareFault() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.fault {
+		return ErrModbusFault
+	}
+	return nil
+}
+
+// Moving reports whether the status register's moving bit is set
+func (d *Modbus) Moving() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status, err := d.status()
+	return err == nil && d.registerMap.bit(status, d.registerMap.MovingBit)
+}
+
+// Stop writes ModbusCommandStop
+func (d *Modbus) Stop() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.writeRegisters(d.registerMap.Command, []uint16{ModbusCommandStop})
+}
+
+// Home writes ModbusCommandHome, starting the positioner's reference search
+func (d *Modbus) Home() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.writeRegisters(d.registerMap.Command, []uint16{ModbusCommandHome}); err != nil {
+		return err
+	}
+	d.referenced = d.registerMap.ReferencedBit < 0
+	return nil
+}
+
+// Referenced reports whether the status register's referenced bit is set
+// (always true if the PLC doesn't report it). If the status can't be read,
+// the last known state is reported.
+func (d *Modbus) Referenced() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	m := d.registerMap
+	if m.ReferencedBit < 0 {
+		return true
+	}
+	if status, err := d.status(); err == nil {
+		d.referenced = m.bit(status, m.ReferencedBit)
+	}
+	return d.referenced
+}
+
+// Capabilities describes the Modbus positioner
+func (d *Modbus) Capabilities() Capabilities {
+	return Capabilities{Model: "modbus (" + d.address + ")", Feedback: true, Homing: d.registerMap.ReferencedBit >= 0, Stop: true}
+}
+
+// Close closes the connection to the Modbus server
+func (d *Modbus) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn == nil {
+		return nil
+	}
+	err := d.conn.Close()
+	d.conn = nil
+	return err
+}
+
+func (d *Modbus) connect() error {
+	conn, err := net.DialTimeout("tcp", d.address, d.timeout)
+	if err != nil {
+		return err
+	}
+	d.conn = conn
+	return nil
+}
+
+func (d *Modbus) status() (uint16, error) {
+	regs, err := d.readRegisters(d.registerMap.Status, 1)
+	if err != nil {
+		return 0, err
+	}
+	return regs[0], nil
+}
+
+// readRegisters reads n holding registers starting at addr
+func (d *Modbus) readRegisters(addr uint16, n int) ([]uint16, error) {
+	pdu := make([]byte, 5)
+	pdu[0] = modbusReadHoldingRegisters
+	binary.BigEndian.PutUint16(pdu[1:], addr)
+	binary.BigEndian.PutUint16(pdu[3:], uint16(n))
+	resp, err := d.request(pdu)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 2+2*n || int(resp[1]) != 2*n {
+		return nil, fmt.Errorf("modbus: malformed response to reading %d registers at %d", n, addr)
+	}
+	regs := make([]uint16, n)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(resp[2+2*i:])
+	}
+	return regs, nil
+}
+
+// writeRegisters writes holding registers starting at addr
+func (d *Modbus) writeRegisters(addr uint16, values []uint16) error {
+	pdu := make([]byte, 6+2*len(values))
+	pdu[0] = modbusWriteMultipleRegisters
+	binary.BigEndian.PutUint16(pdu[1:], addr)
+	binary.BigEndian.PutUint16(pdu[3:], uint16(len(values)))
+	pdu[5] = byte(2 * len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(pdu[6+2*i:], v)
+	}
+	resp, err := d.request(pdu)
+	if err != nil {
+		return err
+	}
+	if len(resp) != 5 || binary.BigEndian.Uint16(resp[1:]) != addr {
+		return fmt.Errorf("modbus: malformed response to writing %d registers at %d", len(values), addr)
+	}
+	return nil
+}
+
+// request sends a PDU to the server and returns the response PDU. Any network
+// error drops the connection so that the next request reconnects.
+func (d *Modbus) request(pdu []byte) ([]byte, error) {
+	if d.conn == nil {
+		if err := d.connect(); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := d.exchange(pdu)
+	if _, ok := err.(ModbusError); err != nil && !ok {
+		d.conn.Close()
+		d.conn = nil
+	}
+	return resp, err
+}
+
+func (d *Modbus) exchange(pdu []byte) ([]byte, error) {
+	d.conn.SetDeadline(time.Now().Add(d.timeout))
+	d.transaction++
+	if err := writeModbusFrame(d.conn, d.transaction, d.unit, pdu); err != nil {
+		return nil, err
+	}
+	transaction, _, resp, err := readModbusFrame(d.conn)
+	if err != nil {
+		return nil, err
+	}
+	if transaction != d.transaction {
+		return nil, fmt.Errorf("modbus: response to transaction %d while awaiting %d", transaction, d.transaction)
+	}
+	if resp[0] == pdu[0]|0x80 && len(resp) == 2 {
+		return nil, ModbusError{Function: pdu[0], Code: resp[1]}
+	}
+	if resp[0] != pdu[0] {
+		return nil, fmt.Errorf("modbus: response to function %#02x while awaiting %#02x", resp[0], pdu[0])
+	}
+	return resp, nil
+}
+
+// writeModbusFrame writes a PDU with a Modbus TCP (MBAP) header
+func writeModbusFrame(w io.Writer, transaction uint16, unit byte, pdu []byte) error {
+	frame := make([]byte, 7+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:], transaction)
+	binary.BigEndian.PutUint16(frame[2:], 0)
+	binary.BigEndian.PutUint16(frame[4:], uint16(1+len(pdu)))
+	frame[6] = unit
+	copy(frame[7:], pdu)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readModbusFrame reads a Modbus TCP (MBAP) frame, returning its transaction
+// ID, unit ID and PDU
+func readModbusFrame(r io.Reader) (uint16, byte, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if binary.BigEndian.Uint16(header[2:]) != 0 || length < 2 || length > 254 {
+		return 0, 0, nil, errors.New("modbus: malformed frame header")
+	}
+	pdu := make([]byte, length-1)
+	if _, err := io.ReadFull(r, pdu); err != nil {
+		return 0, 0, nil, err
+	}
+	return binary.BigEndian.Uint16(header[0:]), header[6], pdu, nil
+}
@@ -0,0 +1,311 @@
+package rotor
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// modbusWriteSingleRegister is the Modbus function code for writing one
+// holding register, which modbusServer also accepts
+const modbusWriteSingleRegister = 0x06
+
+// modbusServer is a minimal in-process Modbus TCP server holding a bank of
+// holding registers, standing in for a positioner's PLC
+type modbusServer struct {
+	mu        sync.Mutex
+	registers [65536]uint16
+	// onRead, if set, is called before holding registers are read
+	onRead func()
+	// onWrite, if set, is called after n holding registers starting at addr
+	// have been written
+	onWrite func(addr uint16, n int)
+}
+
+// newModbusSimulator starts a modbusServer that drives a Simulator like a
+// positioner's PLC, with its registers laid out as described by a ModbusMap,
+// and returns it along with its address. fault, if set, is reported in the
+// status register's fault bit.
+func newModbusSimulator(t *testing.T, sim *Simulator, m ModbusMap, fault func() bool) (*modbusServer, string) {
+	s := &modbusServer{}
+	s.onRead = func() {
+		pos, _ := sim.Position()
+		var status uint16
+		if m.MovingBit >= 0 && sim.Moving() {
+			status |= 1 << uint(m.MovingBit)
+		}
+		if m.FaultBit >= 0 && fault != nil && fault() {
+			status |= 1 << uint(m.FaultBit)
+		}
+		if m.ReferencedBit >= 0 && sim.Referenced() {
+			status |= 1 << uint(m.ReferencedBit)
+		}
+		az, _ := m.encode(pos.Az)
+		el, _ := m.encode(pos.El)
+		s.set(m.ActualAz, az...)
+		s.set(m.ActualEl, el...)
+		s.set(m.Status, status)
+	}
+	s.onWrite = func(addr uint16, n int) {
+		if m.Command < addr || int(m.Command) >= int(addr)+n {
+			return
+		}
+		switch s.get(m.Command, 1)[0] {
+		case ModbusCommandMove:
+			sim.SetTarget(State{Az: m.decode(s.get(m.TargetAz, m.Words)), El: m.decode(s.get(m.TargetEl, m.Words))})
+		case ModbusCommandStop:
+			sim.Stop()
+		case ModbusCommandHome:
+			sim.Home()
+		}
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, l.Addr().String()
+}
+
+func (s *modbusServer) get(addr uint16, n int) []uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	regs := make([]uint16, n)
+	for i := range regs {
+		regs[i] = s.registers[addr+uint16(i)]
+	}
+	return regs
+}
+
+func (s *modbusServer) set(addr uint16, values ...uint16) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, v := range values {
+		s.registers[addr+uint16(i)] = v
+	}
+}
+
+func (s *modbusServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		transaction, unit, pdu, err := readModbusFrame(conn)
+		if err != nil {
+			return
+		}
+		if err := writeModbusFrame(conn, transaction, unit, s.handle(pdu)); err != nil {
+			return
+		}
+	}
+}
+
+// handle carries out a request PDU and returns the response PDU
+func (s *modbusServer) handle(pdu []byte) []byte {
+	exception := func(code byte) []byte {
+		return []byte{pdu[0] | 0x80, code}
+	}
+	switch pdu[0] {
+	case modbusReadHoldingRegisters:
+		addr, n := binary.BigEndian.Uint16(pdu[1:]), int(binary.BigEndian.Uint16(pdu[3:]))
+		if n < 1 || n > 125 || int(addr)+n > 65536 {
+			return exception(2)
+		}
+		if s.onRead != nil {
+			s.onRead()
+		}
+		resp := []byte{pdu[0], byte(2 * n)}
+		for _, v := range s.get(addr, n) {
+			resp = append(resp, byte(v>>8), byte(v))
+		}
+		return resp
+	case modbusWriteSingleRegister:
+		addr := binary.BigEndian.Uint16(pdu[1:])
+		s.set(addr, binary.BigEndian.Uint16(pdu[3:]))
+		if s.onWrite != nil {
+			s.onWrite(addr, 1)
+		}
+		return pdu
+	case modbusWriteMultipleRegisters:
+		addr, n := binary.BigEndian.Uint16(pdu[1:]), int(binary.BigEndian.Uint16(pdu[3:]))
+		if int(pdu[5]) != 2*n || len(pdu) != 6+2*n {
+			return exception(3)
+		}
+		for i := 0; i < n; i++ {
+			s.set(addr+uint16(i), binary.BigEndian.Uint16(pdu[6+2*i:]))
+		}
+		if s.onWrite != nil {
+			s.onWrite(addr, n)
+		}
+		return pdu[:5]
+	default:
+		return exception(1)
+	}
+}
+
+func TestParseModbusMap(t *testing.T) {
+	m, err := ParseModbusMap("target_az=100, target_el=101,scale=10,words=1,referenced_bit=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DefaultModbusMap()
+	want.TargetAz, want.TargetEl, want.Scale, want.Words, want.ReferencedBit = 100, 101, 10, 1, 2
+	if m != want {
+		t.Errorf("got %+v, want %+v", m, want)
+	}
+	for _, bad := range []string{"bogus=1", "target_az", "target_az=70000", "scale=x"} {
+		if _, err := ParseModbusMap(bad); err == nil {
+			t.Errorf("ParseModbusMap(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestModbusMapValidate(t *testing.T) {
+	narrow := DefaultModbusMap()
+	narrow.Words = 1
+	if err := narrow.Validate(DefaultLimits); err == nil {
+		t.Error("16-bit registers at a scale of 100 can't hold 360 degrees, but were accepted")
+	}
+	narrow.Scale = 10
+	if err := narrow.Validate(Limits{MinAz: -180, MaxAz: 450, MinEl: 0, MaxEl: 180}); err != nil {
+		t.Error(err)
+	}
+	if _, err := narrow.encode(3300); err == nil {
+		t.Error("encoding 3300 degrees in 16-bit registers at a scale of 10 succeeded")
+	}
+}
+
+func TestModbusMapEncoding(t *testing.T) {
+	for _, words := range []int{1, 2} {
+		m := DefaultModbusMap()
+		m.Words, m.Scale = words, 10
+		for _, deg := range []float64{0, 12.3, -59.8, 359.9} {
+			regs, err := m.encode(deg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(regs) != words {
+				t.Errorf("%v degrees took %d registers, want %d", deg, len(regs), words)
+			}
+			if got := m.decode(regs); got != deg {
+				t.Errorf("%v degrees in %d words round-tripped to %v", deg, words, got)
+			}
+		}
+	}
+}
+
+func TestModbusDriver(t *testing.T) {
+	m := DefaultModbusMap()
+	sim := NewSimulator(State{Az: 20, El: 10}, SimulatorConfig{MaxRate: 200})
+	_, address := newModbusSimulator(t, sim, m, nil)
+	d, err := NewModbus(address, 1, m, DefaultLimits, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	pos, err := d.Position()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != (State{Az: 20, El: 10}) {
+		t.Errorf("position %v, want 20,10", pos)
+	}
+	if err := d.SetTarget(State{Az: 350.25, El: 45.5}); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Moving() {
+		t.Error("not moving after SetTarget")
+	}
+	r, err := New(d, Config{Limits: DefaultLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Rotate(context.Background(), State{Az: 350.25, El: 45.5}, ControllerManual); err != nil {
+		t.Fatal(err)
+	}
+	if pos := r.Position(); pos != (State{Az: 350.25, El: 45.5}) {
+		t.Errorf("position %v after rotating, want 350.25,45.5", pos)
+	}
+	if _, err := d.readRegisters(65535, 2); err != (ModbusError{Function: modbusReadHoldingRegisters, Code: 2}) {
+		t.Errorf("reading past the last register: got %v, want an illegal data address exception", err)
+	}
+}
+
+func TestModbusFault(t *testing.T) {
+	m := DefaultModbusMap()
+	sim := NewSimulator(State{Az: 20, El: 10}, SimulatorConfig{MaxRate: 20})
+	var mu sync.Mutex
+	faulty := false
+	_, address := newModbusSimulator(t, sim, m, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return faulty
+	})
+	d, err := NewModbus(address, 1, m, DefaultLimits, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(d, Config{Limits: DefaultLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(300*time.Millisecond, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		faulty = true
+	})
+	err = r.Rotate(context.Background(), State{Az: 90, El: 40}, ControllerManual)
+	if f, ok := err.(*Fault); !ok || f.Code != FaultHardware {
+		t.Fatalf("got %v, want a hardware fault", err)
+	}
+	if r.Fault() == nil || !r.Status().Connected {
+		t.Errorf("fault %v, connected %v: want a latched fault on a connected rotor", r.Fault(), r.Status().Connected)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if sim.Moving() {
+		t.Error("positioner still moving after the fault")
+	}
+	if err := r.Rotate(context.Background(), State{Az: 90, El: 40}, ControllerManual); err != ErrFaulted {
+		t.Errorf("got %v after the fault, want ErrFaulted", err)
+	}
+}
+
+func TestModbusHoming(t *testing.T) {
+	m := DefaultModbusMap()
+	m.ReferencedBit = 2
+	sim := NewSimulator(State{Az: 20, El: 10}, SimulatorConfig{MaxRate: 200, Unreferenced: true})
+	_, address := newModbusSimulator(t, sim, m, nil)
+	d, err := NewModbus(address, 1, m, DefaultLimits, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Capabilities().Homing {
+		t.Error("positioner with a referenced bit can't home")
+	}
+	r, err := New(d, Config{Limits: DefaultLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := r.Rotate(ctx, State{Az: 90, El: 40}, ControllerManual); err != ErrUnreferenced {
+		t.Errorf("got %v before homing, want ErrUnreferenced", err)
+	}
+	if err := r.Home(ctx, ControllerManual); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Rotate(ctx, State{Az: 90, El: 40}, ControllerManual); err != nil {
+		t.Errorf("got %v after homing", err)
+	}
+}
@@ -0,0 +1,191 @@
+package rotor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// clearance is how far above an obstruction a detour passes, in degrees
+const clearance = 2.0
+
+// Obstruction is a keep-out zone (e.g. a building, a tree line or another
+// antenna) that the rotor must never point into or sweep through. Polygon
+// lists its vertices as true azimuths and elevations; azimuths may run past
+// 360 for zones that straddle north (e.g. 350 to 370). A horizon mask is an
+// Obstruction along the bottom of the sky.
+type Obstruction struct {
+	Name    string  `json:"name" bson:"name"`
+	Polygon []State `json:"polygon" bson:"polygon"`
+}
+
+// ObstructionError is returned when a target, or every path to it, passes
+// through an Obstruction. State is the offending position, which may lie
+// along the path rather than be the target itself.
+type ObstructionError struct {
+	Obstruction string `json:"obstruction"`
+	State       State  `json:"state"`
+}
+
+func (e *ObstructionError) Error() string {
+	return fmt.Sprintf("rotor: azimuth %.1f elevation %.1f is inside obstruction %q", e.State.Az, e.State.El, e.Obstruction)
+}
+
+// Validate checks that an Obstruction describes a usable polygon
+func (o Obstruction) Validate() error {
+	if len(o.Polygon) < 3 {
+		return fmt.Errorf("rotor: obstruction %q needs at least 3 vertices", o.Name)
+	}
+	for _, v := range o.Polygon {
+		if math.IsNaN(v.Az) || math.IsInf(v.Az, 0) || math.IsNaN(v.El) || math.IsInf(v.El, 0) {
+			return errors.New("rotor: obstruction vertices must be finite")
+		}
+	}
+	return nil
+}
+
+// Contains reports whether a position points into the Obstruction. Positions
+// past the zenith (elevations over 90, when tracking flipped) are taken as the
+// direction they actually point in.
+func (o Obstruction) Contains(s State) bool {
+	if s.El > 90 {
+		s = State{Az: s.Az + 180, El: 180 - s.El}
+	}
+	az := NormalizeAz(s.Az)
+	for _, a := range []float64{az - 360, az, az + 360} {
+		if o.contains(a, s.El) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains is an even-odd ray casting test against the polygon
+func (o Obstruction) contains(az, el float64) bool {
+	inside := false
+	for i, j := 0, len(o.Polygon)-1; i < len(o.Polygon); j, i = i, i+1 {
+		a, b := o.Polygon[i], o.Polygon[j]
+		if (a.El > el) != (b.El > el) && az < (b.Az-a.Az)*(el-a.El)/(b.El-a.El)+a.Az {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// top is the highest elevation of the Obstruction
+func (o Obstruction) top() float64 {
+	top := math.Inf(-1)
+	for _, v := range o.Polygon {
+		top = math.Max(top, v.El)
+	}
+	return top
+}
+
+// Obstructions returns the Rotor's keep-out zones
+func (r *Rotor) Obstructions() []Obstruction {
+	return r.obstructions.Load().([]Obstruction)
+}
+
+// SetObstructions replaces the Rotor's keep-out zones. They take effect from
+// the next command.
+func (r *Rotor) SetObstructions(obs []Obstruction) error {
+	for _, o := range obs {
+		if err := o.Validate(); err != nil {
+			return err
+		}
+	}
+	r.obstructions.Store(append([]Obstruction(nil), obs...))
+	return nil
+}
+
+// obstructed returns the Obstruction a position points into, if any
+func obstructed(obs []Obstruction, s State) (Obstruction, bool) {
+	for _, o := range obs {
+		if o.Contains(s) {
+			return o, true
+		}
+	}
+	return Obstruction{}, false
+}
+
+// sweep checks the path the rotor takes between two mechanical positions,
+// with both axes moving at the same rate until each arrives, returning an
+// *ObstructionError for the first obstructed point
+func sweep(obs []Obstruction, from, to State) error {
+	dAz, dEl := to.Az-from.Az, to.El-from.El
+	steps := int(math.Ceil(math.Max(math.Abs(dAz), math.Abs(dEl))))
+	for i := 1; i <= steps; i++ {
+		d := float64(i)
+		s := State{
+			Az: from.Az + math.Copysign(math.Min(d, math.Abs(dAz)), dAz),
+			El: from.El + math.Copysign(math.Min(d, math.Abs(dEl)), dEl),
+		}
+		if o, ok := obstructed(obs, s); ok {
+			return &ObstructionError{Obstruction: o.Name, State: State{Az: NormalizeAz(s.Az), El: s.El}}
+		}
+	}
+	return nil
+}
+
+// route plans a path of mechanical positions from one mechanical position to
+// a set of candidate targets (the same bearing on different turns of the
+// cable wrap) that stays clear of the Obstructions. The direct path is used
+// if it is clear; otherwise the rotor climbs over the obstruction in the way,
+// slews in azimuth and then descends. Obstructions that the rotor is already
+// inside are ignored so that it can be driven back out of them.
+func (r *Rotor) route(from State, targets []State) ([]State, error) {
+	var obs []Obstruction
+	for _, o := range r.Obstructions() {
+		if !o.Contains(from) {
+			obs = append(obs, o)
+		}
+	}
+	if o, ok := obstructed(obs, targets[0]); ok {
+		return nil, &ObstructionError{Obstruction: o.Name, State: State{Az: NormalizeAz(targets[0].Az), El: targets[0].El}}
+	}
+
+	var firstErr error
+	for _, to := range targets {
+		err := sweep(obs, from, to)
+		if err == nil {
+			return []State{to}, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, to := range targets {
+		el := math.Max(from.El, to.El)
+		for _, o := range obs {
+			el = math.Max(el, o.top()+clearance)
+		}
+		if el > r.Limits().MaxEl {
+			break
+		}
+		path := []State{{Az: from.Az, El: el}, {Az: to.Az, El: el}, to}
+		prev, clear := from, true
+		for _, s := range path {
+			if sweep(obs, prev, s) != nil {
+				clear = false
+				break
+			}
+			prev = s
+		}
+		if clear {
+			return path, nil
+		}
+	}
+	return nil, firstErr
+}
+
+// sendRoute moves the rotor along a path of mechanical positions, one leg at
+// a time
+func (r *Rotor) sendRoute(ctx context.Context, path []State, by Controller) error {
+	for _, s := range path {
+		if err := r.send(ctx, command{target: s, mechanical: true, controller: by, done: make(chan error, 1)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package rotor
+
+import (
+	"context"
+	"testing"
+)
+
+// zone is a rectangular Obstruction from azimuth az0 to az1 and elevation 0
+// to top
+func zone(name string, az0, az1, top float64) Obstruction {
+	return Obstruction{Name: name, Polygon: []State{{Az: az0, El: 0}, {Az: az1, El: 0}, {Az: az1, El: top}, {Az: az0, El: top}}}
+}
+
+func TestObstructionContains(t *testing.T) {
+	tower := zone("tower", 350, 370, 30)
+	for _, tc := range []struct {
+		s    State
+		want bool
+	}{
+		{State{Az: 355, El: 10}, true},
+		{State{Az: 5, El: 10}, true},
+		{State{Az: 365, El: 10}, true},
+		{State{Az: 15, El: 10}, false},
+		{State{Az: 5, El: 40}, false},
+		{State{Az: 185, El: 170}, true},
+		{State{Az: 185, El: 130}, false},
+	} {
+		if got := tower.Contains(tc.s); got != tc.want {
+			t.Errorf("Contains(%v) = %v, want %v", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	obs := []Obstruction{zone("wall", 20, 40, 30)}
+	err := sweep(obs, State{Az: 0, El: 10}, State{Az: 60, El: 10})
+	if oe, ok := err.(*ObstructionError); !ok || oe.Obstruction != "wall" || oe.State != (State{Az: 20, El: 10}) {
+		t.Errorf("got %v sweeping through the wall", err)
+	}
+	if err := sweep(obs, State{Az: 0, El: 40}, State{Az: 60, El: 40}); err != nil {
+		t.Errorf("got %v sweeping over the wall", err)
+	}
+	if err := sweep(obs, State{Az: 60, El: 10}, State{Az: 80, El: 10}); err != nil {
+		t.Errorf("got %v sweeping clear of the wall", err)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	wide := Limits{MinAz: 0, MaxAz: 450, MinEl: 0, MaxEl: 90}
+	for _, tc := range []struct {
+		name    string
+		obs     []Obstruction
+		from    State
+		targets []State
+		want    []State
+		blocked string
+	}{
+		{
+			name:    "direct",
+			obs:     []Obstruction{zone("wall", 20, 40, 30)},
+			from:    State{Az: 50, El: 10},
+			targets: []State{{Az: 80, El: 10}},
+			want:    []State{{Az: 80, El: 10}},
+		},
+		{
+			name:    "over the top",
+			obs:     []Obstruction{zone("wall", 20, 40, 30)},
+			from:    State{Az: 0, El: 10},
+			targets: []State{{Az: 60, El: 10}},
+			want:    []State{{Az: 0, El: 32}, {Az: 60, El: 32}, {Az: 60, El: 10}},
+		},
+		{
+			name:    "the other way round",
+			obs:     []Obstruction{zone("mast", 330, 350, 89)},
+			from:    State{Az: 300, El: 10},
+			targets: []State{{Az: 390, El: 10}, {Az: 30, El: 10}},
+			want:    []State{{Az: 30, El: 10}},
+		},
+		{
+			name:    "target inside",
+			obs:     []Obstruction{zone("wall", 20, 40, 30)},
+			from:    State{Az: 0, El: 10},
+			targets: []State{{Az: 30, El: 10}},
+			blocked: "wall",
+		},
+		{
+			name:    "no way past",
+			obs:     []Obstruction{zone("mast", 330, 350, 89), zone("tree", 100, 120, 89)},
+			from:    State{Az: 300, El: 10},
+			targets: []State{{Az: 390, El: 10}, {Az: 30, El: 10}},
+			blocked: "mast",
+		},
+		{
+			name:    "out of an obstruction",
+			obs:     []Obstruction{zone("wall", 20, 40, 30)},
+			from:    State{Az: 30, El: 10},
+			targets: []State{{Az: 60, El: 10}},
+			want:    []State{{Az: 60, El: 10}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := New(NewSimulator(tc.from, SimulatorConfig{MaxRate: 40}), Config{Limits: wide, Obstructions: tc.obs})
+			if err != nil {
+				t.Fatal(err)
+			}
+			path, err := r.route(tc.from, tc.targets)
+			if tc.blocked != "" {
+				if oe, ok := err.(*ObstructionError); !ok || oe.Obstruction != tc.blocked {
+					t.Errorf("got path %v, error %v: want blocked by %q", path, err, tc.blocked)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(path) != len(tc.want) {
+				t.Fatalf("got path %v, want %v", path, tc.want)
+			}
+			for i := range path {
+				if path[i] != tc.want[i] {
+					t.Errorf("got path %v, want %v", path, tc.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestRotateAroundObstruction(t *testing.T) {
+	wide := Limits{MinAz: 0, MaxAz: 450, MinEl: 0, MaxEl: 90}
+	r, err := New(NewSimulator(State{Az: 300, El: 10}, SimulatorConfig{MaxRate: 400}), Config{
+		Limits:       wide,
+		Obstructions: []Obstruction{zone("mast", 330, 350, 89)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Rotate(context.Background(), State{Az: 30, El: 10}, ControllerManual); err != nil {
+		t.Fatal(err)
+	}
+	if pos := r.MechanicalPosition(); pos.Az > 360 {
+		t.Errorf("rotor at mechanical azimuth %v, want it to have gone the long way round to 30", pos.Az)
+	}
+}
@@ -0,0 +1,54 @@
+package rotor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StowPosition is the name of the park position the rotor returns to when it
+// is not in use
+const StowPosition = "stow"
+
+// ErrUnknownPosition is returned when asked to park at a position that hasn't
+// been configured
+var ErrUnknownPosition = errors.New("rotor: unknown park position")
+
+// ParseState parses a State from an "azimuth,elevation" string (e.g. "0,90"),
+// which is how park positions are configured
+func ParseState(str string) (State, error) {
+	fields := strings.Split(str, ",")
+	if len(fields) != 2 {
+		return State{}, fmt.Errorf("rotor: %q is not in azimuth,elevation form", str)
+	}
+	az, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+	if err != nil {
+		return State{}, fmt.Errorf("rotor: invalid azimuth in %q", str)
+	}
+	el, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil {
+		return State{}, fmt.Errorf("rotor: invalid elevation in %q", str)
+	}
+	return State{Az: az, El: el}, nil
+}
+
+// ParkPositions returns the Rotor's named park positions
+func (r *Rotor) ParkPositions() map[string]State {
+	positions := make(map[string]State, len(r.config.ParkPositions))
+	for name, s := range r.config.ParkPositions {
+		positions[name] = s
+	}
+	return positions
+}
+
+// Park rotates the Rotor to one of its named park positions (e.g.
+// StowPosition), in the same way as Rotate
+func (r *Rotor) Park(ctx context.Context, name string, by Controller) error {
+	s, ok := r.config.ParkPositions[name]
+	if !ok {
+		return ErrUnknownPosition
+	}
+	return r.Rotate(ctx, s, by)
+}
@@ -0,0 +1,184 @@
+package rotor
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	// minObservations is the fewest observations a PointingModel can be
+	// fitted from
+	minObservations = 4
+	// maxModelEl caps the elevation used in the sec/tan terms of a
+	// PointingModel, which blow up at the zenith (for positions over the top,
+	// the elevation is kept at least 180-maxModelEl instead)
+	maxModelEl = 85.0
+)
+
+// ErrTooFewObservations is returned when a PointingModel fit is attempted
+// with fewer than four observations
+var ErrTooFewObservations = errors.New("rotor: at least 4 observations are needed to fit a pointing model")
+
+// ErrIllConditioned is returned when the observations don't constrain every
+// term of a PointingModel (e.g. they are all at the same azimuth)
+var ErrIllConditioned = errors.New("rotor: observations don't constrain the pointing model; spread them across the sky")
+
+// PointingModel corrects for the geometric imperfections of an az/el mount,
+// using the standard terms (in degrees). The correction for a position is
+// added to it on the way to the Driver:
+//
+//	dAz = IA + CA*sec(el) + NPAE*tan(el) + (AN*sin(az) - AW*cos(az))*tan(el)
+//	dEl = IE + AN*cos(az) + AW*sin(az)
+//
+// The zero PointingModel makes no correction.
+type PointingModel struct {
+	// IA is the azimuth encoder zero offset
+	IA float64 `json:"ia" bson:"ia"`
+	// IE is the elevation encoder zero offset
+	IE float64 `json:"ie" bson:"ie"`
+	// CA is the collimation error (the beam not being perpendicular to the
+	// elevation axis)
+	CA float64 `json:"ca" bson:"ca"`
+	// NPAE is the non-perpendicularity of the azimuth and elevation axes
+	NPAE float64 `json:"npae" bson:"npae"`
+	// AN is the tilt of the azimuth axis toward the north
+	AN float64 `json:"an" bson:"an"`
+	// AW is the tilt of the azimuth axis toward the west
+	AW float64 `json:"aw" bson:"aw"`
+	// Observations is the number of observations the model was fitted from
+	Observations int `json:"observations" bson:"observations"`
+	// RMS is the on-sky root mean square residual of the fit
+	RMS float64 `json:"rms" bson:"rms"`
+}
+
+// Observation pairs a commanded position with the position at which the
+// rotor actually saw the signal peak. Observed positions should be recorded
+// with no PointingModel in place.
+type Observation struct {
+	Commanded State `json:"commanded"`
+	Observed  State `json:"observed"`
+}
+
+// modelAngles returns the azimuth and elevation, in radians, at which the
+// model's terms are evaluated for a position. Positions over the top (with an
+// elevation above 90 degrees) are left as they are rather than mapped to the
+// sky, because the terms describe the mount's own axes: e.g. collimation error
+// pulls the beam the other way across the sky once the mount has gone over.
+// Only the elevation is kept away from the zenith, on whichever side it is.
+func modelAngles(s State) (float64, float64) {
+	el := math.Min(s.El, maxModelEl)
+	if s.El > 90 {
+		el = math.Max(s.El, 180-maxModelEl)
+	}
+	return s.Az * math.Pi / 180, el * math.Pi / 180
+}
+
+// correction computes (dAz, dEl) for a position
+func (m PointingModel) correction(s State) (float64, float64) {
+	az, el := modelAngles(s)
+	dAz := m.IA + m.CA/math.Cos(el) + m.NPAE*math.Tan(el) + (m.AN*math.Sin(az)-m.AW*math.Cos(az))*math.Tan(el)
+	dEl := m.IE + m.AN*math.Cos(az) + m.AW*math.Sin(az)
+	return dAz, dEl
+}
+
+// ToDriver applies the model's correction to a position
+func (m PointingModel) ToDriver(s State) State {
+	dAz, dEl := m.correction(s)
+	return State{Az: s.Az + dAz, El: s.El + dEl}
+}
+
+// FromDriver removes the model's correction from a position reported by the
+// Driver (the inverse of ToDriver, found by fixed-point iteration)
+func (m PointingModel) FromDriver(s State) State {
+	out := s
+	for i := 0; i < 4; i++ {
+		dAz, dEl := m.correction(out)
+		out = State{Az: s.Az - dAz, El: s.El - dEl}
+	}
+	return out
+}
+
+// FitPointingModel finds the PointingModel that best explains a set of
+// Observations, by linear least squares
+func FitPointingModel(obs []Observation) (PointingModel, error) {
+	if len(obs) < minObservations {
+		return PointingModel{}, ErrTooFewObservations
+	}
+
+	// each observation gives an (on-sky) azimuth equation and an elevation
+	// equation in the six unknowns IA, IE, CA, NPAE, AN, AW
+	var rows [][]float64
+	var rhs []float64
+	for _, o := range obs {
+		az, el := modelAngles(o.Commanded)
+		cosEl, sinEl := math.Cos(el), math.Sin(el)
+		rows = append(rows, []float64{cosEl, 0, 1, sinEl, math.Sin(az) * sinEl, -math.Cos(az) * sinEl})
+		rhs = append(rhs, AzimuthDifference(o.Commanded.Az, o.Observed.Az)*cosEl)
+		rows = append(rows, []float64{0, 1, 0, 0, math.Cos(az), math.Sin(az)})
+		rhs = append(rhs, o.Observed.El-o.Commanded.El)
+	}
+
+	x, err := leastSquares(rows, rhs)
+	if err != nil {
+		return PointingModel{}, err
+	}
+
+	sumSq := 0.0
+	for i, row := range rows {
+		resid := rhs[i]
+		for j, v := range row {
+			resid -= v * x[j]
+		}
+		sumSq += resid * resid
+	}
+	return PointingModel{
+		IA: x[0], IE: x[1], CA: x[2], NPAE: x[3], AN: x[4], AW: x[5],
+		Observations: len(obs),
+		RMS:          math.Sqrt(sumSq / float64(len(obs))),
+	}, nil
+}
+
+// leastSquares solves the normal equations (A'A)x = A'b by Gaussian
+// elimination with partial pivoting
+func leastSquares(a [][]float64, b []float64) ([]float64, error) {
+	n := len(a[0])
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n+1)
+		for k := range a {
+			for j := 0; j < n; j++ {
+				m[i][j] += a[k][i] * a[k][j]
+			}
+			m[i][n] += a[k][i] * b[k]
+		}
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-9 {
+			return nil, ErrIllConditioned
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		for row := col + 1; row < n; row++ {
+			f := m[row][col] / m[col][col]
+			for j := col; j <= n; j++ {
+				m[row][j] -= f * m[col][j]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := m[row][n]
+		for j := row + 1; j < n; j++ {
+			sum -= m[row][j] * x[j]
+		}
+		x[row] = sum / m[row][row]
+	}
+	return x, nil
+}
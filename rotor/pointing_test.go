@@ -0,0 +1,55 @@
+package rotor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPointingModelOverTheTop(t *testing.T) {
+	// a collimation error pulls the beam toward the same side of the mount
+	// either way, which is the other way across the sky once it has gone over
+	m := PointingModel{CA: 1}
+	if d := m.ToDriver(State{Az: 0, El: 170}); math.Abs(d.Az+1/math.Cos(10*math.Pi/180)) > 1e-9 {
+		t.Errorf("collimation correction over the top %v, want %v", d.Az, -1/math.Cos(10*math.Pi/180))
+	}
+	if a, b := m.ToDriver(State{Az: 0, El: 92}), m.ToDriver(State{Az: 0, El: 88}); math.Abs(a.Az+b.Az) > 1e-9 {
+		t.Errorf("corrections either side of the zenith %v and %v aren't capped alike", b.Az, a.Az)
+	}
+}
+
+func TestFitPointingModel(t *testing.T) {
+	want := PointingModel{IA: 0.5, IE: -0.3, CA: 0.2, NPAE: 0.1, AN: 0.05, AW: -0.04}
+	var obs []Observation
+	for az := 0.0; az < 360; az += 45 {
+		for _, el := range []float64{10, 40, 70, 110, 160} {
+			c := State{Az: az, El: el}
+			obs = append(obs, Observation{Commanded: c, Observed: want.ToDriver(c)})
+		}
+	}
+	got, err := FitPointingModel(obs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, term := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"IA", got.IA, want.IA}, {"IE", got.IE, want.IE}, {"CA", got.CA, want.CA},
+		{"NPAE", got.NPAE, want.NPAE}, {"AN", got.AN, want.AN}, {"AW", got.AW, want.AW},
+	} {
+		if math.Abs(term.got-term.want) > 1e-6 {
+			t.Errorf("%v %v, want %v", term.name, term.got, term.want)
+		}
+	}
+	if got.RMS > 1e-6 {
+		t.Errorf("RMS %v fitting exact observations", got.RMS)
+	}
+
+	s := State{Az: 200, El: 150}
+	if back := got.FromDriver(got.ToDriver(s)); math.Abs(back.Az-s.Az) > 1e-3 || math.Abs(back.El-s.El) > 1e-3 {
+		t.Errorf("%v round-tripped to %v", s, back)
+	}
+	if _, err := FitPointingModel(obs[:3]); err != ErrTooFewObservations {
+		t.Errorf("got %v fitting 3 observations", err)
+	}
+}
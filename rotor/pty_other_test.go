@@ -0,0 +1,13 @@
+//go:build !linux
+
+package rotor
+
+import (
+	"os"
+	"testing"
+)
+
+func openPTY(t *testing.T) (*os.File, string) {
+	t.Skip("pseudo-terminal tests only run on Linux")
+	return nil, ""
+}
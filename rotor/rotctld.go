@@ -0,0 +1,198 @@
+package rotor
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hamlibErrors maps Hamlib's RPRT return codes to descriptions
+var hamlibErrors = map[int]string{
+	-1:  "invalid parameter",
+	-2:  "invalid configuration",
+	-3:  "memory shortage",
+	-4:  "function not implemented",
+	-5:  "communication timed out",
+	-6:  "IO error",
+	-7:  "internal Hamlib error",
+	-8:  "protocol error",
+	-9:  "command rejected by the rotator",
+	-10: "command performed, but arg truncated",
+	-11: "function not available",
+	-12: "VFO not targetable",
+	-13: "error talking on the bus",
+	-14: "collision on the bus",
+	-15: "NULL rotator handle or invalid pointer parameter",
+	-16: "invalid VFO",
+	-17: "argument out of domain of func",
+}
+
+// RotctldError is returned when rotctld answers a command with a non-zero
+// RPRT code
+type RotctldError struct {
+	Code int
+}
+
+func (e RotctldError) Error() string {
+	if desc, ok := hamlibErrors[e.Code]; ok {
+		return fmt.Sprintf("rotctld: RPRT %d (%v)", e.Code, desc)
+	}
+	return fmt.Sprintf("rotctld: RPRT %d", e.Code)
+}
+
+// Rotctld is a Driver that talks to a Hamlib rotctld daemon over TCP. The
+// connection is re-established automatically if it is lost.
+type Rotctld struct {
+	mu      sync.Mutex
+	address string
+	timeout time.Duration
+	conn    net.Conn
+	reader  *bufio.Reader
+	model   string
+}
+
+// NewRotctld connects to the rotctld daemon listening at address (in
+// host:port form). The timeout bounds how long any single command may take.
+func NewRotctld(address string, timeout time.Duration) (*Rotctld, error) {
+	r := &Rotctld{address: address, timeout: timeout}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	// the model is purely informational, so don't fail if it is unavailable
+	if lines, err := r.command("_", 1); err == nil {
+		r.model = lines[0]
+	}
+	return r, nil
+}
+
+// SetTarget sends a "P az el" command
+func (r *Rotctld) SetTarget(s State) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.command(fmt.Sprintf("P %.2f %.2f", s.Az, s.El), 0)
+	return err
+}
+
+// Position sends a "p" command and parses the azimuth and elevation lines
+func (r *Rotctld) Position() (State, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines, err := r.command("p", 2)
+	if err != nil {
+		return State{}, err
+	}
+	az, err := strconv.ParseFloat(lines[0], 64)
+	if err != nil {
+		return State{}, fmt.Errorf("rotctld: invalid azimuth %q", lines[0])
+	}
+	el, err := strconv.ParseFloat(lines[1], 64)
+	if err != nil {
+		return State{}, fmt.Errorf("rotctld: invalid elevation %q", lines[1])
+	}
+	return State{Az: az, El: el}, nil
+}
+
+// Stop sends an "S" command
+func (r *Rotctld) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.command("S", 0)
+	return err
+}
+
+// Park sends a "K" command, moving the rotator to its Hamlib park position
+func (r *Rotctld) Park() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err := r.command("K", 0)
+	return err
+}
+
+// Capabilities describes the rotator behind rotctld
+func (r *Rotctld) Capabilities() Capabilities {
+	model := "rotctld"
+	if r.model != "" {
+		model += " (" + r.model + ")"
+	}
+	return Capabilities{Model: model, Feedback: true, Stop: true}
+}
+
+// Close closes the connection to rotctld
+func (r *Rotctld) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+func (r *Rotctld) connect() error {
+	conn, err := net.DialTimeout("tcp", r.address, r.timeout)
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// command sends cmd to rotctld and reads back nLines lines of data. Commands
+// that return no data (nLines == 0) are answered with an RPRT line, while a
+// failing command that would return data is answered with an RPRT line in
+// place of the data. Any network error drops the connection so that the next
+// command reconnects.
+func (r *Rotctld) command(cmd string, nLines int) ([]string, error) {
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+	}
+	lines, err := r.exchange(cmd, nLines)
+	if _, ok := err.(RotctldError); err != nil && !ok {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return lines, err
+}
+
+func (r *Rotctld) exchange(cmd string, nLines int) ([]string, error) {
+	r.conn.SetDeadline(time.Now().Add(r.timeout))
+	if _, err := r.conn.Write([]byte(cmd + "\n")); err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, nLines)
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "RPRT ") {
+			code, err := strconv.Atoi(strings.TrimPrefix(line, "RPRT "))
+			if err != nil {
+				return nil, fmt.Errorf("rotctld: malformed response %q", line)
+			}
+			if code != 0 {
+				return nil, RotctldError{Code: code}
+			}
+			if len(lines) == nLines {
+				return lines, nil
+			}
+			continue
+		}
+		lines = append(lines, line)
+		if nLines > 0 && len(lines) == nLines {
+			return lines, nil
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package rotor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// acceptWindow is how long ServeRotctld waits for a move to be rejected
+// before reporting it as accepted (rotctld replies before the rotor arrives)
+const acceptWindow = 250 * time.Millisecond
+
+// rotctldModel is the Hamlib model number reported by dump_state
+// (ROT_MODEL_NETROTCTL)
+const rotctldModel = 2
+
+// rotctldLongCommands maps rotctld's long command names to the short ones
+var rotctldLongCommands = map[string]string{
+	`\set_pos`:    "P",
+	`\get_pos`:    "p",
+	`\stop`:       "S",
+	`\park`:       "K",
+	`\reset`:      "R",
+	`\get_info`:   "_",
+	`\dump_state`: `\dump_state`,
+	`\quit`:       "q",
+}
+
+// ServeRotctld accepts connections on l and serves the Hamlib rotctld
+// protocol on each, so that tools like Gpredict can point the Rotor. Moves
+// are subject to the same limits and checks as any other, and are made as
+// ControllerRotctld. Azimuths are taken as bearings (so -90 is 270). It
+// returns when l is closed.
+func (r *Rotor) ServeRotctld(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go r.serveRotctldConn(conn)
+	}
+}
+
+func (r *Rotor) serveRotctldConn(conn net.Conn) {
+	defer conn.Close()
+	addr := conn.RemoteAddr()
+	log.Printf("rotctld client %v connected", addr)
+	defer log.Printf("rotctld client %v disconnected", addr)
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.TrimPrefix(scanner.Text(), "+"))
+		if len(fields) == 0 {
+			continue
+		}
+		cmd := fields[0]
+		if long, ok := rotctldLongCommands[cmd]; ok {
+			cmd = long
+		}
+		var reply string
+		switch cmd {
+		case "P":
+			reply = r.rotctldSetPos(addr, fields[1:])
+		case "p":
+			pos := r.Position()
+			reply = fmt.Sprintf("%.2f\n%.2f\n", pos.Az, pos.El)
+		case "S":
+			log.Printf("rotctld client %v stopped the rotor", addr)
+			reply = rotctldReport(r.Stop())
+		case "K":
+			log.Printf("rotctld client %v parked the rotor", addr)
+			reply = rotctldReport(r.startMove(func(ctx context.Context) error {
+				return r.Park(ctx, StowPosition, ControllerRotctld)
+			}))
+		case "R":
+			log.Printf("rotctld client %v homed the rotor", addr)
+			reply = rotctldReport(r.startMove(func(ctx context.Context) error {
+				return r.Home(ctx, ControllerRotctld)
+			}))
+		case "_":
+			reply = r.Capabilities().Model + "\n"
+		case `\dump_state`:
+			l := r.Limits()
+			reply = fmt.Sprintf("1\n%d\n%f\n%f\n%f\n%f\n", rotctldModel, 0.0, 360.0, l.MinEl, l.MaxEl)
+		case "q", "Q":
+			return
+		default:
+			reply = "RPRT -4\n"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// rotctldSetPos handles a "P az el" command from the client at addr, logging
+// the moves it accepts
+func (r *Rotor) rotctldSetPos(addr net.Addr, args []string) string {
+	if len(args) != 2 {
+		return "RPRT -1\n"
+	}
+	az, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return "RPRT -1\n"
+	}
+	el, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return "RPRT -1\n"
+	}
+	s := State{Az: NormalizeAz(az), El: el}
+	err = r.startMove(func(ctx context.Context) error {
+		return r.Rotate(ctx, s, ControllerRotctld)
+	})
+	if err == nil {
+		log.Printf("rotctld client %v moved the rotor to azimuth %.2f elevation %.2f", addr, s.Az, s.El)
+	}
+	return rotctldReport(err)
+}
+
+// startMove starts a move in the background, returning its error if it fails
+// within the acceptWindow (e.g. because it is outside of the limits) and nil
+// otherwise
+func (r *Rotor) startMove(move func(context.Context) error) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- move(context.Background())
+	}()
+	select {
+	case err := <-result:
+		if err == ErrSuperseded {
+			return nil
+		}
+		return err
+	case <-time.After(acceptWindow):
+		return nil
+	}
+}
+
+// rotctldReport formats an error as a rotctld "RPRT" reply
+func rotctldReport(err error) string {
+	code := 0
+	switch err.(type) {
+	case nil:
+	case *LimitError, *ObstructionError:
+		code = -1
+	case *LeaseError, *DutyCycleError:
+		code = -9
+	default:
+		switch err {
+		case ErrEmergencyStop, ErrFaulted, ErrUnreferenced:
+			code = -9
+		case ErrNotSupported, ErrUnknownPosition:
+			code = -11
+		default:
+			code = -6
+		}
+	}
+	return fmt.Sprintf("RPRT %d\n", code)
+}
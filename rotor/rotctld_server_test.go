@@ -0,0 +1,102 @@
+package rotor
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logBuffer collects log output written from several goroutines
+type logBuffer struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (l *logBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.Write(p)
+}
+
+func (l *logBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.String()
+}
+
+// rotctldClient serves the rotctld protocol for r over a pipe and returns a
+// function that sends a command and reads back its reply of lines lines
+func rotctldClient(t *testing.T, r *Rotor) func(cmd string, lines int) string {
+	client, server := net.Pipe()
+	go r.serveRotctldConn(server)
+	t.Cleanup(func() { client.Close() })
+	reader := bufio.NewReader(client)
+	return func(cmd string, lines int) string {
+		client.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := client.Write([]byte(cmd + "\n")); err != nil {
+			t.Fatalf("%v: %v", cmd, err)
+		}
+		var reply string
+		for i := 0; i < lines; i++ {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("%v: %v", cmd, err)
+			}
+			reply += line
+		}
+		return reply
+	}
+}
+
+func TestServeRotctld(t *testing.T) {
+	var logs logBuffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	r, err := New(NewSimulator(State{Az: 10, El: 10}, SimulatorConfig{MaxRate: 40}), Config{Limits: DefaultLimits})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := rotctldClient(t, r)
+
+	if got := send("p", 2); got != "10.00\n10.00\n" {
+		t.Errorf("got %q for p", got)
+	}
+	if got := send("P 30 200", 1); got != "RPRT -1\n" {
+		t.Errorf("got %q for a target beyond the limits", got)
+	}
+	if got := send("P 30", 1); got != "RPRT -1\n" {
+		t.Errorf("got %q for a target missing its elevation", got)
+	}
+	if got := send("P -330 20", 1); got != "RPRT 0\n" {
+		t.Errorf("got %q for P", got)
+	}
+	if !strings.Contains(logs.String(), "rotctld client pipe moved the rotor to azimuth 30.00 elevation 20.00") {
+		t.Errorf("accepted move not logged with the client's address: %q", logs.String())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for distance(r.Position(), State{Az: 30, El: 20}) > 0.01 && time.Now().Before(deadline) {
+		time.Sleep(pollInterval)
+	}
+	if got := send(`\get_pos`, 2); got != "30.00\n20.00\n" {
+		t.Errorf("got %q for p after the move", got)
+	}
+
+	if got := send("P 200 20", 1); got != "RPRT 0\n" {
+		t.Errorf("got %q for P", got)
+	}
+	if got := send(`\stop`, 1); got != "RPRT 0\n" {
+		t.Errorf("got %q for S", got)
+	}
+	time.Sleep(2 * pollInterval)
+	stopped := r.Position()
+	time.Sleep(4 * pollInterval)
+	if pos := r.Position(); pos != stopped || pos.Az > 150 {
+		t.Errorf("rotor at %v and then %v after S, want it halted short of the target", stopped, pos)
+	}
+}
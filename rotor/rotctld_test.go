@@ -0,0 +1,204 @@
+package rotor
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRotctld is an in-process stand-in for a rotctld daemon that answers
+// each command line with a scripted reply
+type fakeRotctld struct {
+	mu       sync.Mutex
+	replies  map[string]string
+	received []string
+	conns    int
+}
+
+// newFakeRotctld starts a fakeRotctld answering with replies, keyed by the
+// command's first word, and returns it along with its address. A command
+// with no reply gets no answer at all, and a reply of "" drops the
+// connection.
+func newFakeRotctld(t *testing.T, replies map[string]string) (*fakeRotctld, string) {
+	f := &fakeRotctld{replies: replies}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f, l.Addr().String()
+}
+
+func (f *fakeRotctld) serve(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		cmd := scanner.Text()
+		f.mu.Lock()
+		f.received = append(f.received, cmd)
+		reply, ok := f.replies[strings.Fields(cmd)[0]]
+		f.mu.Unlock()
+		if !ok {
+			continue
+		}
+		if reply == "" {
+			return
+		}
+		conn.Write([]byte(reply))
+	}
+}
+
+func (f *fakeRotctld) set(cmd, reply string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replies[cmd] = reply
+}
+
+func (f *fakeRotctld) silence(cmd string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.replies, cmd)
+}
+
+func (f *fakeRotctld) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+func (f *fakeRotctld) last() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.received[len(f.received)-1]
+}
+
+func TestRotctld(t *testing.T) {
+	f, address := newFakeRotctld(t, map[string]string{
+		"_": "Hamlib Dummy\n",
+		"p": "123.450000\n-1.500000\n",
+		"P": "RPRT 0\n",
+		"S": "RPRT 0\n",
+		"K": "RPRT 0\n",
+	})
+	r, err := NewRotctld(address, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if got := r.Capabilities().Model; got != "rotctld (Hamlib Dummy)" {
+		t.Errorf("model %q", got)
+	}
+	pos, err := r.Position()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != (State{Az: 123.45, El: -1.5}) {
+		t.Errorf("position %v, want 123.45,-1.5", pos)
+	}
+	if err := r.SetTarget(State{Az: 10.126, El: 45}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.last(); got != "P 10.13 45.00" {
+		t.Errorf("sent %q", got)
+	}
+	if err := r.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Park(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.last(); got != "K" {
+		t.Errorf("sent %q, want K", got)
+	}
+}
+
+func TestRotctldErrors(t *testing.T) {
+	f, address := newFakeRotctld(t, map[string]string{
+		"_": "RPRT -11\n",
+		"p": "RPRT -5\n",
+		"P": "RPRT -1\n",
+		"S": "RPRT 0\n",
+		"K": "RPRT -4\n",
+	})
+	r, err := NewRotctld(address, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if got := r.Capabilities().Model; got != "rotctld" {
+		t.Errorf("model %q without model information", got)
+	}
+	if _, err := r.Position(); err != (RotctldError{Code: -5}) {
+		t.Errorf("got %v, want RPRT -5", err)
+	}
+	err = r.SetTarget(State{Az: 10, El: 10})
+	if err != (RotctldError{Code: -1}) {
+		t.Errorf("got %v, want RPRT -1", err)
+	}
+	if want := "rotctld: RPRT -1 (invalid parameter)"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if err := r.Park(); err != (RotctldError{Code: -4}) {
+		t.Errorf("got %v from a rotator that can't park, want RPRT -4", err)
+	}
+	// an RPRT error is an answer, so the connection is kept
+	if err := r.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	f.set("p", "north\n10\n")
+	if _, err := r.Position(); err == nil || !strings.Contains(err.Error(), "invalid azimuth") {
+		t.Errorf("got %v, want an invalid azimuth", err)
+	}
+	f.set("p", "RPRT x\n")
+	if _, err := r.Position(); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("got %v, want a malformed response", err)
+	}
+	if n := f.connections(); n != 1 {
+		t.Errorf("%d connections, want 1", n)
+	}
+}
+
+func TestRotctldReconnect(t *testing.T) {
+	f, address := newFakeRotctld(t, map[string]string{"_": "Dummy\n", "p": ""})
+	r, err := NewRotctld(address, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if _, err := r.Position(); err == nil {
+		t.Error("a dropped connection returned a position")
+	}
+	f.silence("p")
+	start := time.Now()
+	if _, err := r.Position(); err == nil {
+		t.Error("a silent rotctld returned a position")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out after %v, want 200ms", elapsed)
+	}
+	f.set("p", "1\n2\n")
+	if _, err := r.Position(); err != nil {
+		t.Fatal(err)
+	}
+	if n := f.connections(); n != 3 {
+		t.Errorf("%d connections, want one per failure plus the first", n)
+	}
+}
@@ -1,16 +1,76 @@
 package rotor
 
 import (
+	"context"
 	"encoding/json"
-	"math"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// Rotor type that stores the current state and rotates
+const (
+	// Tolerance is how close (in degrees) the rotor must be to a target State
+	// on both axes for a rotation to be considered complete
+	Tolerance = 0.5
+	// MoveTimeout is the longest a single rotation may take before it is
+	// abandoned
+	MoveTimeout = 5 * time.Minute
+
+	pollInterval = 100 * time.Millisecond
+	// pollFailures is how many position polls in a row may fail before the
+	// Driver is taken to be disconnected and the move in progress is failed
+	pollFailures = 3
+	// HomeTimeout is the longest homing may take before it is abandoned
+	HomeTimeout = 10 * time.Minute
+	// rateTimeout is how long a rate command lasts; the rotor is stopped if
+	// another doesn't arrive in time
+	rateTimeout = 2 * time.Second
+)
+
+var (
+	// ErrMoveTimeout is returned when the rotor fails to reach its target
+	// within MoveTimeout
+	ErrMoveTimeout = errors.New("rotor: timed out waiting to reach target")
+	// ErrSuperseded is returned by Rotate when a newer target replaces the one
+	// it was waiting on
+	ErrSuperseded = errors.New("rotor: superseded by a newer command")
+	// ErrStopped is returned by Rotate when motion is stopped before the
+	// target is reached
+	ErrStopped = errors.New("rotor: motion stopped")
+	// ErrEmergencyStop is returned when the rotor is (or has just been)
+	// emergency stopped. Commands are rejected with it until the emergency
+	// stop is reset.
+	ErrEmergencyStop = errors.New("rotor: emergency stop is latched")
+	// ErrFaulted is returned for commands sent while a Fault is latched
+	ErrFaulted = errors.New("rotor: a fault is latched")
+	// ErrUnreferenced is returned for commands sent while the rotor's
+	// position is unreferenced (until it has been homed)
+	ErrUnreferenced = errors.New("rotor: position is unreferenced until the rotor is homed")
+)
+
+// Rotor type that stores the current state and rotates by commanding a
+// Driver. The Driver is owned by a controller goroutine that accepts commands
+// through a queue, so the current position can always be read without
+// waiting on a move in progress.
 type Rotor struct {
-	mu sync.RWMutex
-	State
+	config       Config
+	driver       Driver
+	commands     chan command
+	cancels      chan chan error
+	position     atomic.Value // mechanical State, as reported by the Driver
+	calibration  atomic.Value // Calibration
+	model        atomic.Value // PointingModel
+	obstructions atomic.Value // []Obstruction
+	fault        atomic.Value // *Fault, nil unless one is latched
+	target       atomic.Value // *lastTarget, the latest mechanical target
+	feedback     atomic.Value // feedback
+	commanded    atomic.Value // time.Time, when the last command was sent
+	leaseMu      sync.Mutex
+	lease        *Lease
+	duty         dutyTracker
+	estop        int32 // 1 while an emergency stop is latched
+	homing       int32 // 1 while the rotor is being homed
 }
 
 // State type that stores an azimuth and elevation
@@ -19,60 +79,325 @@ type State struct {
 	El float64 `json:"elevation" bson:"elevation"`
 }
 
-// StateFromJSON used for unmarshalling of the State type
-func StateFromJSON(data []byte) State {
-	s := State{}
-	err := json.Unmarshal(data, &s)
+// Config describes the rotor being controlled
+type Config struct {
+	// Limits are the rotor's hardware travel, in the Driver's coordinates
+	// (before the Calibration is removed)
+	Limits        Limits
+	Calibration   Calibration
+	PointingModel PointingModel
+	// Obstructions are keep-out zones the rotor must never point into
+	Obstructions []Obstruction
+	// ParkPositions are named positions (e.g. StowPosition) that the rotor
+	// can be sent to with Park
+	ParkPositions map[string]State
+	// StallWindow is how long the position may go unchanged during a move
+	// (or while moving at a rate) before a FaultStall is raised (0 disables
+	// the check)
+	StallWindow time.Duration
+	// DivergenceLimit is how far, in degrees, the position may move away
+	// from the target during a move (or against the commanded direction
+	// while moving at a rate) before a FaultDivergence is raised (0 disables
+	// the check)
+	DivergenceLimit float64
+	// Compensation adjusts commands for backlash and ignores corrections
+	// within a dead-band
+	Compensation Compensation
+	// DutyCycle is the fraction of the DutyWindow that each axis's motor may
+	// run for (0 disables the limit). Commands needing an axis that has used
+	// up its budget are rejected with a *DutyCycleError, and moves are
+	// stopped if an axis runs out partway through.
+	DutyCycle  float64
+	DutyWindow time.Duration
+	// OnFault, if set, is called (in its own goroutine) whenever a Fault is
+	// raised
+	OnFault func(Fault)
+}
+
+// New creates a Rotor that controls the given Driver, starting from the
+// Driver's reported position, and starts its controller
+func New(d Driver, c Config) (*Rotor, error) {
+	pos, err := d.Position()
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	r := &Rotor{config: c, driver: d, commands: make(chan command), cancels: make(chan chan error)}
+	r.calibration.Store(c.Calibration)
+	r.model.Store(c.PointingModel)
+	r.fault.Store((*Fault)(nil))
+	r.duty.cycle, r.duty.window = c.DutyCycle, c.DutyWindow
+	r.target.Store((*lastTarget)(nil))
+	r.commanded.Store(time.Time{})
+	r.feedback.Store(feedback{connected: true, referenced: referenced(d), updated: time.Now()})
+	if err := r.SetObstructions(c.Obstructions); err != nil {
+		return nil, err
+	}
+	r.position.Store(r.fromDriver(pos))
+	go r.run()
+	return r, nil
+}
+
+// StateFromJSON used for unmarshalling of the State type. Both the azimuth
+// and elevation must be given.
+func StateFromJSON(data []byte) (State, error) {
+	var fields struct {
+		Az *float64 `json:"azimuth"`
+		El *float64 `json:"elevation"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return State{}, err
 	}
-	return s
+	if fields.Az == nil || fields.El == nil {
+		return State{}, errors.New("rotor: state requires both azimuth and elevation")
+	}
+	return State{Az: *fields.Az, El: *fields.El}, nil
 }
 
-// ToJSON used for marshalling the Rotor type (in a concurrency-safe way)
-func (r *Rotor) ToJSON() []byte {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	jsonData, err := json.Marshal(r)
+// Capabilities describes what the Rotor's Driver supports
+func (r *Rotor) Capabilities() Capabilities {
+	return r.driver.Capabilities()
+}
+
+// Limits returns the Rotor's soft limits in calibrated coordinates: the
+// Config's hardware travel with the Calibration removed, so that (for
+// example) a rotor whose zero points 3.5 degrees east of north has 3.5-363.5
+// degrees of azimuth travel. Commands are checked against the hardware travel
+// again once the PointingModel has been applied.
+func (r *Rotor) Limits() Limits {
+	c, l := r.Calibration(), r.config.Limits
+	min, max := c.FromDriver(State{Az: l.MinAz, El: l.MinEl}), c.FromDriver(State{Az: l.MaxAz, El: l.MaxEl})
+	return Limits{MinAz: min.Az, MaxAz: max.Az, MinEl: min.El, MaxEl: max.El}
+}
+
+// Calibration returns the Calibration currently applied to commands sent to
+// the Driver
+func (r *Rotor) Calibration() Calibration {
+	return r.calibration.Load().(Calibration)
+}
+
+// SetCalibration replaces the Calibration applied to commands sent to the
+// Driver. It takes effect from the next command and position update.
+func (r *Rotor) SetCalibration(c Calibration) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	r.calibration.Store(c)
+	return nil
+}
+
+// PointingModel returns the PointingModel currently applied to commands sent
+// to the Driver
+func (r *Rotor) PointingModel() PointingModel {
+	return r.model.Load().(PointingModel)
+}
+
+// SetPointingModel replaces the PointingModel applied to commands sent to the
+// Driver. It takes effect from the next command and position update.
+func (r *Rotor) SetPointingModel(m PointingModel) {
+	r.model.Store(m)
+}
+
+// toDriver converts a mechanical position into the Driver's coordinates by
+// applying the PointingModel and then the Calibration
+func (r *Rotor) toDriver(s State) State {
+	return r.Calibration().ToDriver(r.PointingModel().ToDriver(s))
+}
+
+// fromDriver converts a position reported by the Driver back into a
+// mechanical position (the inverse of toDriver)
+func (r *Rotor) fromDriver(s State) State {
+	return r.PointingModel().FromDriver(r.Calibration().FromDriver(s))
+}
+
+// Rotate used for rotating the Rotor to a desired state. It blocks until the
+// target is reached, a newer target supersedes it (ErrSuperseded), motion is
+// stopped (ErrStopped) or ctx is done, in which case the rotor is stopped.
+// Targets outside of the Rotor's Limits are rejected with a *LimitError. The
+// target azimuth is a 0-360 bearing; for rotors with more than a full turn of
+// travel, the shortest legal path within the cable wrap is taken. Targets
+// inside an Obstruction are rejected with an *ObstructionError, and moves
+// whose direct path sweeps through one are routed around it where possible.
+// The Controller issuing the command is reported in the Rotor's Status, and
+// the command is rejected with a *LeaseError if another Controller holds the
+// Lease.
+func (r *Rotor) Rotate(ctx context.Context, s State, by Controller) error {
+	if err := r.checkLease(by); err != nil {
+		return err
+	}
+	l := r.Limits()
+	if err := l.Validate(s); err != nil {
+		return err
+	}
+	from := r.MechanicalPosition()
+	az, _ := l.Unwrap(s.Az, from.Az)
+	targets := []State{{Az: az, El: s.El}}
+	for _, alt := range []float64{az - 360, az + 360} {
+		if alt >= l.MinAz && alt <= l.MaxAz {
+			targets = append(targets, State{Az: alt, El: s.El})
+		}
+	}
+	path, err := r.route(from, targets)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if err := r.checkDutyPath(from, path); err != nil {
+		return err
+	}
+	if len(path) > 1 || path[0] != targets[0] {
+		return r.sendRoute(ctx, path, by)
 	}
-	return jsonData
+	return r.send(ctx, command{target: s, controller: by, done: make(chan error, 1)})
 }
 
-func (r *Rotor) rotate(s State) {
-	// TODO: need to add actual rotation stuff here
+// RotateMechanical is like Rotate, but the target is a mechanical position:
+// the azimuth is taken as-is (e.g. 400 on a 0-450 rotor) rather than as a
+// bearing to reach by the shortest path. It is used when the path has been
+// planned ahead of time.
+func (r *Rotor) RotateMechanical(ctx context.Context, s State, by Controller) error {
+	if err := r.checkLease(by); err != nil {
+		return err
+	}
+	if err := r.Limits().ValidateMechanical(s); err != nil {
+		return err
+	}
+	from := r.MechanicalPosition()
+	path, err := r.route(from, []State{s})
+	if err != nil {
+		return err
+	}
+	if err := r.checkDutyPath(from, path); err != nil {
+		return err
+	}
+	return r.sendRoute(ctx, path, by)
+}
+
+// SetRate moves the Rotor continuously at a rate on each axis, superseding any
+// rotation in progress, for Drivers that support it (otherwise
+// ErrNotSupported is returned). It returns as soon as the rate is applied.
+// Rates lapse after a couple of seconds, so they must be commanded
+// repeatedly, and the rotor is stopped if it reaches its Limits or an
+// Obstruction. Like Rotate, it is subject to the Lease.
+func (r *Rotor) SetRate(ctx context.Context, v Velocity, by Controller) error {
+	if err := r.checkLease(by); err != nil {
+		return err
+	}
+	if err := r.duty.check(v.Az != 0, v.El != 0); err != nil {
+		return err
+	}
+	return r.send(ctx, command{rate: &v, controller: by, done: make(chan error, 1)})
+}
+
+// Home drives the Rotor to its limit or index switches to re-reference its
+// position, for Drivers that support it (otherwise ErrNotSupported is
+// returned). Until homing completes, a rotor whose Driver has lost its
+// reference refuses every other command with ErrUnreferenced. It blocks until
+// homing completes, it is stopped (ErrStopped), it times out or ctx is done,
+// in which case the rotor is stopped. Like Rotate, it is subject to the
+// Lease.
+func (r *Rotor) Home(ctx context.Context, by Controller) error {
+	if err := r.checkLease(by); err != nil {
+		return err
+	}
+	if err := r.duty.check(true, true); err != nil {
+		return err
+	}
+	return r.send(ctx, command{home: true, controller: by, done: make(chan error, 1)})
+}
+
+// Referenced reports whether the Rotor's position is referenced. Only
+// Drivers that implement Homer can be unreferenced.
+func (r *Rotor) Referenced() bool {
+	return r.feedback.Load().(feedback).referenced
+}
+
+// Homing reports whether the Rotor is being homed
+func (r *Rotor) Homing() bool {
+	return atomic.LoadInt32(&r.homing) == 1
+}
 
-	deltaAz := math.Copysign(0.1, s.Az-r.Az)
-	for a := r.Az; a <= s.Az; a += deltaAz {
-		time.Sleep(10 * time.Millisecond)
-		r.Az = a
+// send queues a command for the controller and waits for its outcome
+func (r *Rotor) send(ctx context.Context, c command) error {
+	select {
+	case r.commands <- c:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-c.done:
+		return err
+	case <-ctx.Done():
+		r.cancels <- c.done
+		return ctx.Err()
 	}
+}
+
+// Stop halts the Rotor's motion
+func (r *Rotor) Stop() error {
+	c := command{stop: true, done: make(chan error, 1)}
+	r.commands <- c
+	return <-c.done
+}
+
+// EmergencyStop immediately halts the Rotor and latches it in a stopped
+// state, in which every Rotate fails with ErrEmergencyStop until
+// ResetEmergencyStop is called
+func (r *Rotor) EmergencyStop() error {
+	atomic.StoreInt32(&r.estop, 1)
+	return r.Stop()
+}
+
+// ResetEmergencyStop releases a latched emergency stop so that the Rotor
+// accepts commands again
+func (r *Rotor) ResetEmergencyStop() {
+	atomic.StoreInt32(&r.estop, 0)
+}
 
-	deltaEl := math.Copysign(0.1, s.El-r.El)
-	for e := r.El; e <= s.El; e += deltaEl {
-		time.Sleep(10 * time.Millisecond)
-		r.El = e
+// EmergencyStopped reports whether an emergency stop is latched
+func (r *Rotor) EmergencyStopped() bool {
+	return atomic.LoadInt32(&r.estop) == 1
+}
+
+// Position returns a snapshot of the current position of the Rotor, with the
+// azimuth as a 0-360 bearing
+func (r *Rotor) Position() State {
+	mech := r.MechanicalPosition()
+	return State{Az: NormalizeAz(mech.Az), El: mech.El}
+}
+
+// Target returns the position the Rotor was most recently commanded to, with
+// the azimuth as a 0-360 bearing, or false if it hasn't been commanded yet
+func (r *Rotor) Target() (State, bool) {
+	t := r.target.Load().(*lastTarget)
+	if t == nil {
+		return State{}, false
 	}
+	return State{Az: NormalizeAz(t.Az), El: t.El}, true
+}
+
+// LastCommand returns when the Rotor was last sent a command (the zero Time if
+// it hasn't been)
+func (r *Rotor) LastCommand() time.Time {
+	return r.commanded.Load().(time.Time)
+}
+
+// Wrap returns a snapshot of where the Rotor sits within its cable wrap
+func (r *Rotor) Wrap() WrapState {
+	return r.Limits().Wrap(r.MechanicalPosition().Az)
 }
 
-// Rotate used for rotating the Rotor to a desired state
-func (r *Rotor) Rotate(s State) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.rotate(s)
+// MechanicalPosition returns a snapshot of the current position of the Rotor
+// as reported by its Driver (after calibration and the pointing model), with
+// the azimuth unwrapped
+func (r *Rotor) MechanicalPosition() State {
+	return r.position.Load().(State)
 }
 
 // GetAz is a concurrency-safe retreival method for the current azimuth of the Rotor
 func (r *Rotor) GetAz() float64 {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	return r.Az
+	return r.Position().Az
 }
 
 // GetEl is a concurrency-safe retreival method for the current elevation of the Rotor
 func (r *Rotor) GetEl() float64 {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	return r.El
+	return r.Position().El
 }
@@ -0,0 +1,123 @@
+package rotor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+// ErrResponseTimeout is returned when a serial rotor controller does not
+// answer a command in time
+var ErrResponseTimeout = errors.New("rotor: timed out waiting for controller response")
+
+// OpenSerial opens a serial port (e.g. /dev/ttyUSB0) at the given baud rate
+// for use by one of the serial Drivers
+func OpenSerial(port string, baud int) (io.ReadWriteCloser, error) {
+	return serial.OpenPort(&serial.Config{Name: port, Baud: baud})
+}
+
+// link wraps the connection to a serial controller. It reads in the
+// background so that responses can be awaited with a timeout regardless of
+// what kind of io.ReadWriteCloser (a serial port, a pseudo-terminal, a pipe)
+// is underneath.
+type link struct {
+	rw      io.ReadWriteCloser
+	timeout time.Duration
+	data    chan []byte
+	readErr error
+	buf     []byte
+}
+
+func newLink(rw io.ReadWriteCloser, timeout time.Duration) *link {
+	l := &link{rw: rw, timeout: timeout, data: make(chan []byte, 16)}
+	go l.readLoop()
+	return l
+}
+
+func (l *link) readLoop() {
+	for {
+		b := make([]byte, 256)
+		n, err := l.rw.Read(b)
+		if n > 0 {
+			l.data <- b[:n]
+		}
+		if err != nil {
+			l.readErr = err
+			close(l.data)
+			return
+		}
+	}
+}
+
+// flush discards anything received but not yet consumed, so that a stale or
+// unsolicited response isn't mistaken for the answer to the next command
+func (l *link) flush() {
+	l.buf = nil
+	for {
+		select {
+		case _, ok := <-l.data:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *link) write(p []byte) error {
+	_, err := l.rw.Write(p)
+	return err
+}
+
+// fill waits for more data to arrive before the deadline
+func (l *link) fill(deadline <-chan time.Time) error {
+	select {
+	case b, ok := <-l.data:
+		if !ok {
+			if l.readErr != nil {
+				return l.readErr
+			}
+			return io.EOF
+		}
+		l.buf = append(l.buf, b...)
+		return nil
+	case <-deadline:
+		return ErrResponseTimeout
+	}
+}
+
+// readUntil reads up to and including the first occurrence of delim
+func (l *link) readUntil(delim byte) ([]byte, error) {
+	deadline := time.After(l.timeout)
+	for {
+		if i := bytes.IndexByte(l.buf, delim); i >= 0 {
+			out := l.buf[:i+1]
+			l.buf = l.buf[i+1:]
+			return out, nil
+		}
+		if err := l.fill(deadline); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readN reads exactly n bytes
+func (l *link) readN(n int) ([]byte, error) {
+	deadline := time.After(l.timeout)
+	for len(l.buf) < n {
+		if err := l.fill(deadline); err != nil {
+			return nil, err
+		}
+	}
+	out := l.buf[:n]
+	l.buf = l.buf[n:]
+	return out, nil
+}
+
+func (l *link) close() error {
+	return l.rw.Close()
+}
@@ -0,0 +1,68 @@
+package rotor
+
+import (
+	"bufio"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeController plays a serial rotor controller on the master end of a
+// pseudo-terminal, answering each command with a scripted reply
+type fakeController struct {
+	mu       sync.Mutex
+	reply    func(cmd string) string
+	received []string
+}
+
+// newFakeController starts a fakeController reading commands terminated by
+// delim, and returns it along with the port a Driver should talk to it on
+func newFakeController(t *testing.T, delim byte, reply func(cmd string) string) (*fakeController, io.ReadWriteCloser) {
+	master, slave := openPTY(t)
+	f := &fakeController{reply: reply}
+	go func() {
+		r := bufio.NewReader(master)
+		for {
+			cmd, err := r.ReadString(delim)
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.received = append(f.received, cmd)
+			resp := f.reply(cmd)
+			f.mu.Unlock()
+			master.Write([]byte(resp))
+		}
+	}()
+	port, err := OpenSerial(slave, 9600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// hang up first, so that the blocked read on the port returns
+		master.Close()
+		port.Close()
+	})
+	return f, port
+}
+
+func (f *fakeController) last() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.received) == 0 {
+		return ""
+	}
+	return f.received[len(f.received)-1]
+}
+
+// await waits for the fake to receive a command
+func (f *fakeController) await(t *testing.T, cmd string) {
+	deadline := time.Now().Add(time.Second)
+	for f.last() != cmd {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %q, want %q", f.last(), cmd)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
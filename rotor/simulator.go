@@ -0,0 +1,237 @@
+package rotor
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// simulatorStep is the integration step used to advance the simulation
+const simulatorStep = 10 * time.Millisecond
+
+// SimulatorConfig describes the dynamics of a simulated rotor, which are the
+// same for both axes
+type SimulatorConfig struct {
+	// MaxRate is the top slew rate in degrees per second
+	MaxRate float64
+	// Acceleration is in degrees per second squared (0 means the axes reach
+	// MaxRate instantly)
+	Acceleration float64
+	// SettleTime is how long the rotor is still considered to be moving after
+	// both axes have arrived at the target
+	SettleTime time.Duration
+	// Unreferenced makes the Simulator start without a position reference,
+	// like a positioner that has just been powered on, so that it must be
+	// homed (to its index switches at 0,0) before it can be used
+	Unreferenced bool
+}
+
+// Simulator is a Driver that pretends to be a rotor. Both axes move at the
+// same time, accelerating up to a maximum rate and decelerating so as to stop
+// on the target. It is useful for development and dry runs without hardware.
+type Simulator struct {
+	mu        sync.Mutex
+	config    SimulatorConfig
+	az        simulatedAxis
+	el        simulatedAxis
+	updated   time.Time
+	settledAt time.Time
+	// referenced is false until homing completes, and homing is set while
+	// it is in progress
+	referenced bool
+	homing     bool
+}
+
+type simulatedAxis struct {
+	pos    float64
+	vel    float64
+	target float64
+	// rateMode is set while the axis is moving at a commanded rate rather
+	// than toward the target
+	rateMode bool
+	rate     float64
+}
+
+// NewSimulator creates a Simulator at rest at the given State
+func NewSimulator(initial State, c SimulatorConfig) *Simulator {
+	now := time.Now()
+	return &Simulator{
+		config:     c,
+		az:         simulatedAxis{pos: initial.Az, target: initial.Az},
+		el:         simulatedAxis{pos: initial.El, target: initial.El},
+		updated:    now,
+		settledAt:  now,
+		referenced: !c.Unreferenced,
+	}
+}
+
+// SetTarget starts the Simulator moving toward a State, replacing any move
+// already in progress
+func (s *Simulator) SetTarget(target State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	s.az.target, s.az.rateMode = target.Az, false
+	s.el.target, s.el.rateMode = target.El, false
+	s.homing = false
+	return nil
+}
+
+// SetRate starts each axis moving continuously at a rate (limited to the
+// MaxRate), replacing any move already in progress
+func (s *Simulator) SetRate(az, el float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	s.az.rateMode, s.az.rate = true, az
+	s.el.rateMode, s.el.rate = true, el
+	s.homing = false
+	return nil
+}
+
+// Home starts the Simulator moving to its index switches at 0,0, where its
+// position becomes referenced
+func (s *Simulator) Home() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	s.az.target, s.az.rateMode = 0, false
+	s.el.target, s.el.rateMode = 0, false
+	s.referenced, s.homing = false, true
+	return nil
+}
+
+// Referenced reports whether the Simulator has been homed (or didn't need to
+// be)
+func (s *Simulator) Referenced() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	return s.referenced
+}
+
+// Position reports the simulated position
+func (s *Simulator) Position() (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	return State{Az: s.az.pos, El: s.el.pos}, nil
+}
+
+// Moving reports whether either axis is moving or the rotor is still settling
+// after a move
+func (s *Simulator) Moving() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.advance(now)
+	return !s.az.arrived() || !s.el.arrived() || now.Before(s.settledAt)
+}
+
+// Stop decelerates both axes to a halt as quickly as possible
+func (s *Simulator) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance(time.Now())
+	s.az.target, s.az.rateMode = s.az.stoppingPoint(s.config.Acceleration), false
+	s.el.target, s.el.rateMode = s.el.stoppingPoint(s.config.Acceleration), false
+	s.homing = false
+	return nil
+}
+
+// Capabilities describes the Simulator
+func (s *Simulator) Capabilities() Capabilities {
+	return Capabilities{Model: "simulator", Feedback: true, Velocity: true, Homing: true, Stop: true}
+}
+
+// advance integrates the motion of both axes up to now
+func (s *Simulator) advance(now time.Time) {
+	wasMoving := !s.az.arrived() || !s.el.arrived()
+	for s.updated.Before(now) {
+		dt := simulatorStep
+		if remaining := now.Sub(s.updated); remaining < dt {
+			dt = remaining
+		}
+		s.az.step(dt.Seconds(), s.config)
+		s.el.step(dt.Seconds(), s.config)
+		s.updated = s.updated.Add(dt)
+		if wasMoving && s.az.arrived() && s.el.arrived() {
+			s.settledAt = s.updated.Add(s.config.SettleTime)
+			wasMoving = false
+		}
+		if s.homing && s.az.arrived() && s.el.arrived() {
+			s.referenced, s.homing = true, false
+		}
+	}
+}
+
+func (a *simulatedAxis) arrived() bool {
+	if a.rateMode {
+		return a.rate == 0 && a.vel == 0
+	}
+	return a.pos == a.target && a.vel == 0
+}
+
+// stoppingPoint is where the axis would come to rest if it began decelerating
+// now
+func (a *simulatedAxis) stoppingPoint(accel float64) float64 {
+	if accel <= 0 {
+		return a.pos
+	}
+	return a.pos + math.Copysign(a.vel*a.vel/(2*accel), a.vel)
+}
+
+// step advances the axis by dt seconds, accelerating toward the target (in
+// either direction) unless it is time to start braking
+func (a *simulatedAxis) step(dt float64, c SimulatorConfig) {
+	if a.arrived() {
+		return
+	}
+	if a.rateMode {
+		a.stepRate(dt, c)
+		return
+	}
+	dist := a.target - a.pos
+	if c.Acceleration <= 0 {
+		a.vel = math.Copysign(c.MaxRate, dist)
+	} else {
+		stopping := a.vel * a.vel / (2 * c.Acceleration)
+		if a.vel != 0 && (math.Signbit(a.vel) != math.Signbit(dist) || math.Abs(dist) <= stopping) {
+			// brake, either because we're heading the wrong way or we'd
+			// otherwise overshoot
+			dv := math.Min(math.Abs(a.vel), c.Acceleration*dt)
+			a.vel -= math.Copysign(dv, a.vel)
+		} else {
+			a.vel += math.Copysign(c.Acceleration*dt, dist)
+			if math.Abs(a.vel) > c.MaxRate {
+				a.vel = math.Copysign(c.MaxRate, a.vel)
+			}
+		}
+	}
+
+	move := a.vel * dt
+	if math.Abs(dist) <= math.Abs(move) && math.Signbit(move) == math.Signbit(dist) {
+		// the target is reached within this step
+		a.pos = a.target
+		a.vel = 0
+		return
+	}
+	a.pos += move
+	if math.Abs(a.target-a.pos) < 1e-6 && math.Abs(a.vel) <= c.Acceleration*dt {
+		a.pos = a.target
+		a.vel = 0
+	}
+}
+
+// stepRate advances an axis in rate mode by dt seconds, accelerating toward
+// the commanded rate
+func (a *simulatedAxis) stepRate(dt float64, c SimulatorConfig) {
+	want := math.Max(-c.MaxRate, math.Min(c.MaxRate, a.rate))
+	dv := want - a.vel
+	if c.Acceleration > 0 && math.Abs(dv) > c.Acceleration*dt {
+		dv = math.Copysign(c.Acceleration*dt, dv)
+	}
+	a.vel += dv
+	a.pos += a.vel * dt
+	a.target = a.pos
+}
@@ -0,0 +1,131 @@
+package rotor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// elapse advances a Simulator's clock by d without waiting for it, returning
+// its position
+func elapse(s *Simulator, d time.Duration) State {
+	s.advance(s.updated.Add(d))
+	return State{Az: s.az.pos, El: s.el.pos}
+}
+
+func near(a, b State) bool {
+	return math.Abs(a.Az-b.Az) < 1e-6 && math.Abs(a.El-b.El) < 1e-6
+}
+
+func TestSimulatorConcurrentAxes(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		from, to State
+		after1s  State
+		after4s  State
+	}{
+		{"increasing", State{Az: 40, El: 10}, State{Az: 100, El: 50}, State{Az: 50, El: 20}, State{Az: 80, El: 50}},
+		{"decreasing", State{Az: 100, El: 50}, State{Az: 40, El: 10}, State{Az: 90, El: 40}, State{Az: 60, El: 10}},
+		{"mixed", State{Az: 100, El: 10}, State{Az: 40, El: 50}, State{Az: 90, El: 20}, State{Az: 60, El: 50}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewSimulator(tc.from, SimulatorConfig{MaxRate: 10})
+			s.SetTarget(tc.to)
+			if pos := elapse(s, time.Second); !near(pos, tc.after1s) {
+				t.Errorf("at %v after 1s, want %v", pos, tc.after1s)
+			}
+			if pos := elapse(s, 3*time.Second); !near(pos, tc.after4s) {
+				t.Errorf("at %v after 4s, want %v", pos, tc.after4s)
+			}
+			if pos := elapse(s, 3*time.Second); pos != tc.to || !s.az.arrived() || !s.el.arrived() {
+				t.Errorf("at %v after 7s, want arrived at %v", pos, tc.to)
+			}
+		})
+	}
+}
+
+func TestSimulatorAcceleration(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		from, to float64
+	}{
+		{"increasing", 60, 100},
+		{"decreasing", 100, 60},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// 2s to reach 10 deg/s over 10 degrees, 2s at 10 deg/s and 2s
+			// braking over the last 10 degrees
+			s := NewSimulator(State{Az: tc.from}, SimulatorConfig{MaxRate: 10, Acceleration: 5})
+			s.SetTarget(State{Az: tc.to})
+			dir := math.Copysign(1, tc.to-tc.from)
+			if pos := elapse(s, time.Second); math.Abs(pos.Az-(tc.from+dir*2.5)) > 0.1 {
+				t.Errorf("at %v after 1s, want %v", pos.Az, tc.from+dir*2.5)
+			}
+			if pos := elapse(s, 2*time.Second); math.Abs(pos.Az-(tc.from+dir*20)) > 0.1 || math.Abs(s.az.vel) != 10 {
+				t.Errorf("at %v moving at %v after 3s, want %v at full rate", pos.Az, s.az.vel, tc.from+dir*20)
+			}
+			for i := 0; i < 400; i++ {
+				pos := elapse(s, simulatorStep)
+				if (pos.Az-tc.to)*dir > 1e-9 {
+					t.Fatalf("overshot the target to %v", pos.Az)
+				}
+			}
+			if !s.az.arrived() || s.az.pos != tc.to {
+				t.Errorf("at %v moving at %v, want arrived at %v", s.az.pos, s.az.vel, tc.to)
+			}
+		})
+	}
+}
+
+func TestSimulatorReversal(t *testing.T) {
+	s := NewSimulator(State{Az: 100}, SimulatorConfig{MaxRate: 10, Acceleration: 5})
+	s.SetTarget(State{Az: 200})
+	elapse(s, 3*time.Second)
+	s.SetTarget(State{Az: 50})
+	furthest := s.az.stoppingPoint(s.config.Acceleration)
+	for i := 0; i < 2000; i++ {
+		pos := elapse(s, simulatorStep)
+		if pos.Az > furthest+1e-9 {
+			t.Fatalf("carried on to %v, past the stopping point %v", pos.Az, furthest)
+		}
+		if pos.Az < 50-1e-9 {
+			t.Fatalf("overshot the new target to %v", pos.Az)
+		}
+	}
+	if !s.az.arrived() || s.az.pos != 50 {
+		t.Errorf("at %v moving at %v, want arrived at 50", s.az.pos, s.az.vel)
+	}
+}
+
+func TestSimulatorStop(t *testing.T) {
+	s := NewSimulator(State{Az: 100, El: 60}, SimulatorConfig{MaxRate: 10, Acceleration: 5})
+	s.SetTarget(State{Az: 20, El: 10})
+	elapse(s, 3*time.Second)
+	s.Stop()
+	want := State{Az: s.az.target, El: s.el.target}
+	if math.Abs(want.Az-70) > 0.1 || math.Abs(want.El-30) > 0.1 {
+		t.Errorf("stopping at %v, want 10 degrees on from full rate", want)
+	}
+	if pos := elapse(s, 3*time.Second); !near(pos, want) || !s.az.arrived() || !s.el.arrived() {
+		t.Errorf("at %v after stopping, want halted at %v", pos, want)
+	}
+}
+
+func TestSimulatorRate(t *testing.T) {
+	s := NewSimulator(State{Az: 100, El: 40}, SimulatorConfig{MaxRate: 10})
+	s.SetRate(-5, 20)
+	if pos := elapse(s, 2*time.Second); !near(pos, State{Az: 90, El: 60}) {
+		t.Errorf("at %v after 2s, want the azimuth falling at 5 deg/s and the elevation rising at the 10 deg/s limit", pos)
+	}
+}
+
+func TestSimulatorSettleTime(t *testing.T) {
+	s := NewSimulator(State{Az: 10}, SimulatorConfig{MaxRate: 10, SettleTime: time.Second})
+	s.SetTarget(State{Az: 0})
+	start := s.updated
+	elapse(s, 2*time.Second)
+	// arriving after 1s, give or take a step
+	if settle := s.settledAt.Sub(start); settle < 2*time.Second || settle > 2*time.Second+simulatorStep {
+		t.Errorf("settling until %v after the start, want 2s", settle)
+	}
+}
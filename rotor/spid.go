@@ -0,0 +1,139 @@
+package rotor
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rot2Prog frame bytes
+const (
+	spidStart  = 'W'
+	spidEnd    = 0x20
+	spidStop   = 0x0F
+	spidStatus = 0x1F
+	spidSet    = 0x2F
+
+	spidCommandLength  = 13
+	spidResponseLength = 12
+)
+
+// SPID is a Driver for SPID Rot2Prog and MD-01/MD-02 controllers, which speak
+// a fixed-length binary frame protocol over a serial line
+type SPID struct {
+	mu       sync.Mutex
+	link     *link
+	azPulses int
+	elPulses int
+}
+
+// spidPulses reports whether a controller can be configured with a number of
+// pulses per degree. Only these resolutions (1, 0.5, 0.25 and 0.1 degrees)
+// keep every angle within the set frame's four digits.
+func spidPulses(pulses int) bool {
+	switch pulses {
+	case 1, 2, 4, 10:
+		return true
+	}
+	return false
+}
+
+// NewSPID creates a SPID Driver that talks to a controller over rw (usually a
+// port opened with OpenSerial). The pulses-per-degree values must match the
+// controller's configured resolution (1, 2, 4 or 10, e.g. 2 for 0.5 degree
+// steps). The timeout bounds how long to wait for a status frame.
+func NewSPID(rw io.ReadWriteCloser, azPulses, elPulses int, timeout time.Duration) (*SPID, error) {
+	if !spidPulses(azPulses) || !spidPulses(elPulses) {
+		return nil, fmt.Errorf("spid: pulses per degree must be 1, 2, 4 or 10 (got %d, %d)", azPulses, elPulses)
+	}
+	return &SPID{link: newLink(rw, timeout), azPulses: azPulses, elPulses: elPulses}, nil
+}
+
+// SetTarget sends a set command frame
+func (p *SPID) SetTarget(s State) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, err := p.frame(s, spidSet)
+	if err != nil {
+		return err
+	}
+	return p.link.write(f)
+}
+
+// Position sends a status command frame and decodes the response
+func (p *SPID) Position() (State, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.exchange(spidStatus)
+}
+
+// Stop sends a stop command frame. The controller answers with the position
+// at which it stopped, which is discarded.
+func (p *SPID) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.exchange(spidStop)
+	return err
+}
+
+// Capabilities describes the SPID controller
+func (p *SPID) Capabilities() Capabilities {
+	return Capabilities{Model: "SPID Rot2Prog", Feedback: true, Stop: true}
+}
+
+// Close closes the serial connection
+func (p *SPID) Close() error {
+	return p.link.close()
+}
+
+// frame builds a 13 byte command frame. The set command carries the target
+// encoded as ASCII digits of pulses*(angle+360), while the stop and status
+// commands carry zeros. An angle that doesn't fit in four digits is an error.
+func (p *SPID) frame(s State, cmd byte) ([]byte, error) {
+	var az, el int
+	if cmd == spidSet {
+		az = int(math.Round(float64(p.azPulses) * (s.Az + 360)))
+		el = int(math.Round(float64(p.elPulses) * (s.El + 360)))
+		if az < 0 || az > 9999 || el < 0 || el > 9999 {
+			return nil, fmt.Errorf("spid: target %v can't be encoded at %d,%d pulses per degree", s, p.azPulses, p.elPulses)
+		}
+	}
+	f := make([]byte, 0, spidCommandLength)
+	f = append(f, spidStart)
+	f = append(f, fmt.Sprintf("%04d", az)...)
+	f = append(f, byte(p.azPulses))
+	f = append(f, fmt.Sprintf("%04d", el)...)
+	f = append(f, byte(p.elPulses), cmd, spidEnd)
+	return f, nil
+}
+
+func (p *SPID) exchange(cmd byte) (State, error) {
+	p.link.flush()
+	f, _ := p.frame(State{}, cmd)
+	if err := p.link.write(f); err != nil {
+		return State{}, err
+	}
+	resp, err := p.link.readN(spidResponseLength)
+	if err != nil {
+		return State{}, err
+	}
+	return parseSPIDResponse(resp)
+}
+
+// parseSPIDResponse decodes a 12 byte status frame, whose angles are sent as
+// raw (not ASCII) digits of hundreds, tens, ones and tenths of angle+360
+func parseSPIDResponse(resp []byte) (State, error) {
+	if resp[0] != spidStart || resp[spidResponseLength-1] != spidEnd {
+		return State{}, fmt.Errorf("spid: malformed response % x", resp)
+	}
+	for _, i := range []int{1, 2, 3, 4, 6, 7, 8, 9} {
+		if resp[i] > 9 {
+			return State{}, fmt.Errorf("spid: malformed response % x", resp)
+		}
+	}
+	az := float64(resp[1])*100 + float64(resp[2])*10 + float64(resp[3]) + float64(resp[4])/10 - 360
+	el := float64(resp[6])*100 + float64(resp[7])*10 + float64(resp[8]) + float64(resp[9])/10 - 360
+	return State{Az: az, El: el}, nil
+}
@@ -0,0 +1,39 @@
+package rotor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSPIDPulses(t *testing.T) {
+	for _, pulses := range []int{0, 3, 20, 255} {
+		if _, err := NewSPID(nil, pulses, 2, time.Second); err == nil {
+			t.Errorf("%d pulses per degree accepted", pulses)
+		}
+	}
+}
+
+func TestSPID(t *testing.T) {
+	// the controller answers every frame with its position, 123.4,45.6
+	status := string([]byte{'W', 4, 8, 3, 4, 10, 4, 0, 5, 6, 10, spidEnd})
+	f, port := newFakeController(t, spidEnd, func(string) string { return status })
+	p, err := NewSPID(port, 10, 10, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos, err := p.Position()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos.Az < 123.39 || pos.Az > 123.41 || pos.El < 45.59 || pos.El > 45.61 {
+		t.Errorf("position %v, want 123.4,45.6", pos)
+	}
+	if err := p.SetTarget(State{Az: 450, El: 180}); err != nil {
+		t.Fatal(err)
+	}
+	f.await(t, "W8100\x0a5400\x0a\x2f\x20")
+	if err := p.SetTarget(State{Az: 640, El: 0}); err == nil {
+		t.Error("a target beyond the frame's four digits was sent")
+	}
+}
@@ -0,0 +1,130 @@
+package rotor
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Controller identifies who issued a command to the Rotor
+type Controller string
+
+// Controllers
+const (
+	// ControllerManual is an operator commanding the rotor through the API
+	ControllerManual Controller = "manual"
+	// ControllerExecutor is the executor tracking a scheduled pass
+	ControllerExecutor Controller = "executor"
+	// ControllerPark is the rotor being stowed automatically
+	ControllerPark Controller = "park"
+	// ControllerRotctld is a client (e.g. Gpredict) commanding the rotor
+	// through ServeRotctld
+	ControllerRotctld Controller = "rotctld"
+)
+
+// Velocity is the rate at which each axis is moving, in degrees per second
+type Velocity struct {
+	Az float64 `json:"azimuth"`
+	El float64 `json:"elevation"`
+}
+
+// Status describes what the Rotor is doing
+type Status struct {
+	State
+	// Target is the most recently commanded position (nil if the rotor
+	// hasn't been commanded since the service started)
+	Target *State `json:"target"`
+	// Controller issued the most recent command
+	Controller Controller `json:"controller,omitempty"`
+	Velocity   Velocity   `json:"velocity"`
+	Moving     bool       `json:"moving"`
+	// Connected is false if the last attempt to read the position from the
+	// Driver failed
+	Connected bool `json:"connected"`
+	// Updated is when the position was last read from the Driver
+	Updated time.Time `json:"updated"`
+	// Referenced is false while the rotor's position is unknown (e.g. after
+	// a power cycle) and it must be homed
+	Referenced    bool `json:"referenced"`
+	Homing        bool `json:"homing"`
+	EmergencyStop bool `json:"emergency_stop"`
+	// Stoppable is false if the rotor can't be halted partway through a move
+	// (e.g. EasyComm I), so that stopping it only blocks further commands
+	Stoppable bool `json:"stoppable"`
+	// Faults lists the codes of everything stopping the rotor from accepting
+	// commands (e.g. "emergency_stop", "stall" or "unreferenced")
+	Faults []string `json:"faults"`
+	Fault  *Fault   `json:"fault"`
+	// Lease is the control lease, if one is held
+	Lease *Lease `json:"lease"`
+	// Duty is the duty cycle budget of each axis, if the rotor has a duty
+	// cycle limit
+	Duty *DutyStatus `json:"duty"`
+	// Compensation is the backlash and dead-band compensation applied to
+	// commands
+	Compensation Compensation `json:"compensation"`
+	Limits       Limits       `json:"limits"`
+	Wrap         WrapState    `json:"wrap"`
+}
+
+// feedback is the controller's latest reading of the Driver
+type feedback struct {
+	velocity   Velocity
+	moving     bool
+	connected  bool
+	referenced bool
+	updated    time.Time
+}
+
+// lastTarget is the controller's latest target and who commanded it
+type lastTarget struct {
+	State
+	controller Controller
+}
+
+// Status returns a snapshot of what the Rotor is doing
+func (r *Rotor) Status() Status {
+	fb := r.feedback.Load().(feedback)
+	s := Status{
+		State:         r.Position(),
+		Velocity:      fb.velocity,
+		Moving:        fb.moving,
+		Connected:     fb.connected,
+		Updated:       fb.updated,
+		Referenced:    fb.referenced,
+		Homing:        r.Homing(),
+		EmergencyStop: r.EmergencyStopped(),
+		Stoppable:     r.driver.Capabilities().Stop,
+		Faults:        []string{},
+		Fault:         r.Fault(),
+		Duty:          r.Duty(),
+		Compensation:  r.config.Compensation,
+		Limits:        r.Limits(),
+		Wrap:          r.Wrap(),
+	}
+	if t, ok := r.Target(); ok {
+		s.Target = &t
+		s.Controller = r.target.Load().(*lastTarget).controller
+	}
+	if l, ok := r.Lease(); ok {
+		s.Lease = &l
+	}
+	if s.EmergencyStop {
+		s.Faults = append(s.Faults, "emergency_stop")
+	}
+	if s.Fault != nil {
+		s.Faults = append(s.Faults, s.Fault.Code)
+	}
+	if !s.Referenced {
+		s.Faults = append(s.Faults, "unreferenced")
+	}
+	return s
+}
+
+// ToJSON used for marshalling the Rotor type (in a concurrency-safe way)
+func (r *Rotor) ToJSON() []byte {
+	jsonData, err := json.Marshal(r.Status())
+	if err != nil {
+		panic(err)
+	}
+	return jsonData
+}
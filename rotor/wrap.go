@@ -0,0 +1,63 @@
+package rotor
+
+import "math"
+
+// WrapState describes where a rotor sits within its cable wrap. Rotors with
+// more than 360 degrees of azimuth travel (e.g. 0-450) can reach some
+// azimuths in two ways, so the mechanical (unwrapped) azimuth is tracked
+// alongside the displayed 0-360 value.
+type WrapState struct {
+	// Unwrapped is the mechanical azimuth, which may be outside of 0-360
+	Unwrapped float64 `json:"unwrapped_azimuth"`
+	// CWMargin is how much further the rotor can turn clockwise
+	CWMargin float64 `json:"cw_margin"`
+	// CCWMargin is how much further the rotor can turn counterclockwise
+	CCWMargin float64 `json:"ccw_margin"`
+	// Overlap is true if the current azimuth can also be reached a full turn
+	// away
+	Overlap bool `json:"overlap"`
+}
+
+// NormalizeAz maps an azimuth onto [0, 360)
+func NormalizeAz(az float64) float64 {
+	az = math.Mod(az, 360)
+	if az < 0 {
+		az += 360
+	}
+	return az
+}
+
+// AzimuthDifference returns the signed shortest angle (in (-180, 180]) from
+// azimuth a to azimuth b
+func AzimuthDifference(a, b float64) float64 {
+	d := NormalizeAz(b - a)
+	if d > 180 {
+		d -= 360
+	}
+	return d
+}
+
+// Unwrap finds the mechanical azimuth equivalent to az (i.e. az plus some
+// number of full turns) that is within the Limits and closest to the
+// mechanical azimuth from, which is the shortest legal move. It returns false
+// if no equivalent azimuth is within the Limits.
+func (l Limits) Unwrap(az, from float64) (float64, bool) {
+	base := NormalizeAz(az)
+	best, found := 0.0, false
+	for cand := base + 360*math.Ceil((l.MinAz-base)/360); cand <= l.MaxAz; cand += 360 {
+		if !found || math.Abs(cand-from) < math.Abs(best-from) {
+			best, found = cand, true
+		}
+	}
+	return best, found
+}
+
+// Wrap describes a mechanical azimuth's position within the Limits
+func (l Limits) Wrap(unwrapped float64) WrapState {
+	return WrapState{
+		Unwrapped: unwrapped,
+		CWMargin:  l.MaxAz - unwrapped,
+		CCWMargin: unwrapped - l.MinAz,
+		Overlap:   unwrapped+360 <= l.MaxAz || unwrapped-360 >= l.MinAz,
+	}
+}
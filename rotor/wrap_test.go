@@ -0,0 +1,38 @@
+package rotor
+
+import "testing"
+
+func TestUnwrap(t *testing.T) {
+	wide := Limits{MinAz: 0, MaxAz: 450, MinEl: 0, MaxEl: 90}
+	south := Limits{MinAz: -180, MaxAz: 180, MinEl: 0, MaxEl: 90}
+	narrow := Limits{MinAz: 100, MaxAz: 200, MinEl: 0, MaxEl: 90}
+	for _, tc := range []struct {
+		name     string
+		limits   Limits
+		az, from float64
+		want     float64
+		ok       bool
+	}{
+		{"overlap, onward through north", wide, 20, 350, 380, true},
+		{"overlap, first turn", wide, 20, 10, 20, true},
+		{"overlap, back from the second turn", wide, 80, 430, 440, true},
+		{"overlap, first turn from beyond it", wide, 80, 100, 80, true},
+		{"outside the overlap", wide, 200, 430, 200, true},
+		{"the long way round on 360 degrees of travel", DefaultLimits, 1, 359, 1, true},
+		{"bearing past 360", wide, 380, 10, 20, true},
+		{"negative bearing", wide, -90, 0, 270, true},
+		{"stop in the south", south, 270, 0, -90, true},
+		{"minimum end", wide, 0, 40, 0, true},
+		{"maximum end", wide, 90, 400, 450, true},
+		{"maximum end of 360 degrees of travel", DefaultLimits, 0, 359, 360, true},
+		{"minimum end of a stop in the south", south, 180, -170, -180, true},
+		{"within partial travel", narrow, 150, 100, 150, true},
+		{"beyond partial travel", narrow, 300, 150, 0, false},
+		{"short of partial travel", narrow, 50, 150, 0, false},
+	} {
+		got, ok := tc.limits.Unwrap(tc.az, tc.from)
+		if ok != tc.ok || ok && got != tc.want {
+			t.Errorf("%v: Unwrap(%v, %v) = %v, %v, want %v, %v", tc.name, tc.az, tc.from, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
@@ -13,6 +14,8 @@ import (
 	"github.com/gavincmartin/rotor-control-service/integrations"
 	"github.com/gavincmartin/rotor-control-service/passes"
 	"github.com/gavincmartin/rotor-control-service/rotor"
+	"github.com/gavincmartin/rotor-control-service/settings"
+	"github.com/gavincmartin/rotor-control-service/telemetry"
 	"github.com/globalsign/mgo/bson"
 	"github.com/gorilla/mux"
 	"github.com/robfig/cron"
@@ -21,7 +24,9 @@ import (
 
 var (
 	db            = passes.DAO{}
-	rotctl        = rotor.Rotor{State: rotor.State{Az: 0.0, El: 0.0}}
+	settingsDB    = settings.DAO{}
+	telemetryDB   = telemetry.DAO{}
+	rotctl        *rotor.Rotor
 	updates       = make(chan struct{})
 	abortCommands = make(chan struct{})
 	passTracker   executor.Executor
@@ -31,11 +36,28 @@ func main() {
 	r := mux.NewRouter()
 	r.HandleFunc("/api/rotor", GetRotorStateEndpoint).Methods("GET")
 	r.HandleFunc("/api/rotor", SetRotorStateEndpoint).Methods("POST")
+	r.HandleFunc("/api/rotor/stop", EmergencyStopEndpoint).Methods("POST")
+	r.HandleFunc("/api/rotor/reset", ResetEmergencyStopEndpoint).Methods("POST")
+	r.HandleFunc("/api/rotor/home", HomeEndpoint).Methods("POST")
+	r.HandleFunc("/api/rotor/history", GetRotorHistoryEndpoint).Methods("GET")
+	r.HandleFunc("/api/rotor/lease", GetLeaseEndpoint).Methods("GET")
+	r.HandleFunc("/api/rotor/lease", AcquireLeaseEndpoint).Methods("PUT")
+	r.HandleFunc("/api/rotor/lease", ReleaseLeaseEndpoint).Methods("DELETE")
+	r.HandleFunc("/api/rotor/park", GetParkPositionsEndpoint).Methods("GET")
+	r.HandleFunc("/api/rotor/park/{name}", ParkEndpoint).Methods("POST")
+	r.HandleFunc("/api/rotor/calibration", GetCalibrationEndpoint).Methods("GET")
+	r.HandleFunc("/api/rotor/calibration", UpdateCalibrationEndpoint).Methods("PUT")
+	r.HandleFunc("/api/rotor/obstructions", GetObstructionsEndpoint).Methods("GET")
+	r.HandleFunc("/api/rotor/obstructions", UpdateObstructionsEndpoint).Methods("PUT")
+	r.HandleFunc("/api/rotor/pointing-model", GetPointingModelEndpoint).Methods("GET")
+	r.HandleFunc("/api/rotor/pointing-model", FitPointingModelEndpoint).Methods("POST")
+	r.HandleFunc("/api/rotor/pointing-model", DeletePointingModelEndpoint).Methods("DELETE")
 	r.HandleFunc("/api/passes", GetPassesEndpoint).Methods("GET")
 	r.HandleFunc("/api/passes", AddPassEndpoint).Methods("POST")
 	r.HandleFunc("/api/passes/{id}", GetPassByIDEndpoint).Methods("GET")
 	r.HandleFunc("/api/passes/{id}", UpdatePassEndpoint).Methods("PUT")
 	r.HandleFunc("/api/passes/{id}", DeletePassEndpoint).Methods("DELETE")
+	r.HandleFunc("/api/passes/{id}/plan", GetPassPlanEndpoint).Methods("GET")
 	r.HandleFunc("/api/test", TestEndpoint).Methods("GET")
 	http.ListenAndServe(":"+strconv.Itoa(viper.GetInt("Port")), r)
 }
@@ -52,10 +74,122 @@ func init() {
 	viper.BindEnv("SlackPOSTUrl", "SLACK_POST_URL")
 	viper.SetDefault("SlackSchedulePOSTTime", "09:00 America/Chicago")
 	viper.BindEnv("SlackSchedulePOSTTime", "SLACK_SCHEDULE_POST_TIME")
+	viper.SetDefault("RotorName", "default")
+	viper.BindEnv("RotorName", "ROTOR_NAME")
+	viper.SetDefault("RotorDriver", "simulator")
+	viper.BindEnv("RotorDriver", "ROTOR_DRIVER")
+	viper.SetDefault("RotorMinAzimuth", rotor.DefaultLimits.MinAz)
+	viper.BindEnv("RotorMinAzimuth", "ROTOR_MIN_AZIMUTH")
+	viper.SetDefault("RotorMaxAzimuth", rotor.DefaultLimits.MaxAz)
+	viper.BindEnv("RotorMaxAzimuth", "ROTOR_MAX_AZIMUTH")
+	viper.SetDefault("RotorMinElevation", rotor.DefaultLimits.MinEl)
+	viper.BindEnv("RotorMinElevation", "ROTOR_MIN_ELEVATION")
+	viper.SetDefault("RotorMaxElevation", rotor.DefaultLimits.MaxEl)
+	viper.BindEnv("RotorMaxElevation", "ROTOR_MAX_ELEVATION")
+	viper.SetDefault("RotorParkStow", "0,90")
+	viper.BindEnv("RotorParkStow", "ROTOR_PARK_STOW")
+	viper.SetDefault("RotorParkMaintenance", "180,0")
+	viper.BindEnv("RotorParkMaintenance", "ROTOR_PARK_MAINTENANCE")
+	viper.SetDefault("RotorParkZenith", "0,90")
+	viper.BindEnv("RotorParkZenith", "ROTOR_PARK_ZENITH")
+	viper.SetDefault("StowAfterPass", false)
+	viper.BindEnv("StowAfterPass", "STOW_AFTER_PASS")
+	viper.SetDefault("StowDelay", "5m")
+	viper.BindEnv("StowDelay", "STOW_DELAY")
+	viper.SetDefault("LeasePolicy", "wait")
+	viper.BindEnv("LeasePolicy", "LEASE_POLICY")
+	viper.SetDefault("RateTracking", false)
+	viper.BindEnv("RateTracking", "RATE_TRACKING")
+	viper.SetDefault("RateTrackingGain", 0.5)
+	viper.BindEnv("RateTrackingGain", "RATE_TRACKING_GAIN")
+	viper.SetDefault("RotorDutyCycle", 0.0)
+	viper.BindEnv("RotorDutyCycle", "ROTOR_DUTY_CYCLE")
+	viper.SetDefault("RotorDutyWindow", "10m")
+	viper.BindEnv("RotorDutyWindow", "ROTOR_DUTY_WINDOW")
+	viper.SetDefault("RotorAzimuthBacklash", 0.0)
+	viper.BindEnv("RotorAzimuthBacklash", "ROTOR_AZ_BACKLASH")
+	viper.SetDefault("RotorElevationBacklash", 0.0)
+	viper.BindEnv("RotorElevationBacklash", "ROTOR_EL_BACKLASH")
+	viper.SetDefault("RotorAzimuthDeadBand", 0.0)
+	viper.BindEnv("RotorAzimuthDeadBand", "ROTOR_AZ_DEAD_BAND")
+	viper.SetDefault("RotorElevationDeadBand", 0.0)
+	viper.BindEnv("RotorElevationDeadBand", "ROTOR_EL_DEAD_BAND")
+	viper.SetDefault("RotorStallWindow", "10s")
+	viper.BindEnv("RotorStallWindow", "ROTOR_STALL_WINDOW")
+	viper.SetDefault("RotorDivergenceLimit", 5)
+	viper.BindEnv("RotorDivergenceLimit", "ROTOR_DIVERGENCE_LIMIT")
+	viper.SetDefault("RotorFlipMode", false)
+	viper.BindEnv("RotorFlipMode", "ROTOR_FLIP_MODE")
+	viper.SetDefault("RotorMaxAzimuthRate", 0.0)
+	viper.BindEnv("RotorMaxAzimuthRate", "ROTOR_MAX_AZIMUTH_RATE")
+	viper.SetDefault("SimulatorMaxRate", 6.0)
+	viper.BindEnv("SimulatorMaxRate", "SIMULATOR_MAX_RATE")
+	viper.SetDefault("SimulatorAcceleration", 3.0)
+	viper.BindEnv("SimulatorAcceleration", "SIMULATOR_ACCELERATION")
+	viper.SetDefault("SimulatorSettleTime", "500ms")
+	viper.BindEnv("SimulatorSettleTime", "SIMULATOR_SETTLE_TIME")
+	viper.SetDefault("SimulatorUnreferenced", false)
+	viper.BindEnv("SimulatorUnreferenced", "SIMULATOR_UNREFERENCED")
+	viper.SetDefault("TelemetryInterval", "1s")
+	viper.BindEnv("TelemetryInterval", "TELEMETRY_INTERVAL")
+	viper.SetDefault("TelemetryRetention", "720h")
+	viper.BindEnv("TelemetryRetention", "TELEMETRY_RETENTION")
+	viper.SetDefault("RotctldListenAddress", "")
+	viper.BindEnv("RotctldListenAddress", "ROTCTLD_LISTEN_ADDRESS")
+	viper.SetDefault("RotctldAddress", "localhost:4533")
+	viper.BindEnv("RotctldAddress", "ROTCTLD_ADDRESS")
+	viper.SetDefault("RotctldTimeout", "5s")
+	viper.BindEnv("RotctldTimeout", "ROTCTLD_TIMEOUT")
+	viper.SetDefault("RotorSerialPort", "/dev/ttyUSB0")
+	viper.BindEnv("RotorSerialPort", "ROTOR_SERIAL_PORT")
+	viper.SetDefault("RotorSerialBaud", 9600)
+	viper.BindEnv("RotorSerialBaud", "ROTOR_SERIAL_BAUD")
+	viper.SetDefault("RotorSerialTimeout", "2s")
+	viper.BindEnv("RotorSerialTimeout", "ROTOR_SERIAL_TIMEOUT")
+	viper.SetDefault("SPIDAzPulses", 2)
+	viper.BindEnv("SPIDAzPulses", "SPID_AZ_PULSES")
+	viper.SetDefault("SPIDElPulses", 2)
+	viper.BindEnv("SPIDElPulses", "SPID_EL_PULSES")
+	viper.SetDefault("EasyCommVersion", 2)
+	viper.BindEnv("EasyCommVersion", "EASYCOMM_VERSION")
+	viper.SetDefault("ModbusAddress", "localhost:502")
+	viper.BindEnv("ModbusAddress", "MODBUS_ADDRESS")
+	viper.SetDefault("ModbusUnitID", 1)
+	viper.BindEnv("ModbusUnitID", "MODBUS_UNIT_ID")
+	viper.SetDefault("ModbusTimeout", "2s")
+	viper.BindEnv("ModbusTimeout", "MODBUS_TIMEOUT")
+	viper.SetDefault("ModbusRegisterMap", "")
+	viper.BindEnv("ModbusRegisterMap", "MODBUS_REGISTER_MAP")
 
 	db.Server = viper.GetString("MongoServer")
 	db.Database = viper.GetString("MongoDatabaseName")
 	db.Connect()
+	settingsDB.Server = db.Server
+	settingsDB.Database = db.Database
+	settingsDB.Connect()
+	telemetryDB.Server = db.Server
+	telemetryDB.Database = db.Database
+	telemetryDB.Connect()
+	if err := telemetryDB.EnsureIndex(viper.GetDuration("TelemetryRetention")); err != nil {
+		log.Fatal(err)
+	}
+
+	rotorSettings, err := settingsDB.FindByRotor(viper.GetString("RotorName"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	driver, err := newRotorDriver()
+	if err != nil {
+		log.Fatal(err)
+	}
+	config, err := rotorConfig(rotorSettings)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rotctl, err = rotor.New(driver, config)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	nextPass, err := db.GetNextPass()
 	if err != nil {
@@ -63,9 +197,45 @@ func init() {
 	}
 
 	// start the executor
-	passTracker = executor.Executor{Rotctl: &rotctl, DB: db, Updates: updates, AbortCommands: abortCommands, NextPass: nextPass}
+	planner := executor.Planner{
+		Limits:    rotctl.Limits(),
+		FlipMode:  viper.GetBool("RotorFlipMode"),
+		MaxAzRate: viper.GetFloat64("RotorMaxAzimuthRate"),
+	}
+	leasePolicy := executor.LeasePolicy(viper.GetString("LeasePolicy"))
+	if leasePolicy != executor.LeaseWait && leasePolicy != executor.LeaseSkip && leasePolicy != executor.LeasePreempt {
+		log.Fatalf("Invalid LEASE_POLICY: %v", leasePolicy)
+	}
+	passTracker = executor.Executor{
+		Rotctl:        rotctl,
+		DB:            db,
+		Updates:       updates,
+		AbortCommands: abortCommands,
+		NextPass:      nextPass,
+		Planner:       planner,
+		StowAfterPass: viper.GetBool("StowAfterPass"),
+		StowDelay:     viper.GetDuration("StowDelay"),
+		RateTracking:  viper.GetBool("RateTracking"),
+		RateGain:      viper.GetFloat64("RateTrackingGain"),
+		LeasePolicy:   leasePolicy,
+	}
 	go passTracker.Run()
 
+	// serve the rotctld protocol (e.g. for Gpredict)
+	if address := viper.GetString("RotctldListenAddress"); address != "" {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go rotctl.ServeRotctld(listener)
+	}
+
+	// start recording telemetry
+	if interval := viper.GetDuration("TelemetryInterval"); interval > 0 {
+		recorder := telemetry.Recorder{Rotctl: rotctl, DB: telemetryDB, Interval: interval}
+		go recorder.Run()
+	}
+
 	// schedule a cron job to send daily schedules via Slack
 	scheduleSlackCronJob()
 }
@@ -83,17 +253,345 @@ func TestEndpoint(w http.ResponseWriter, r *http.Request) {
 
 // GetRotorStateEndpoint delivers the Rotor's State upon a GET request
 func GetRotorStateEndpoint(w http.ResponseWriter, r *http.Request) {
-	safeRespondWithJSON(w, http.StatusOK, &rotctl)
+	safeRespondWithJSON(w, http.StatusOK, rotctl)
 }
 
-// SetRotorStateEndpoint alters the Rotor's State upon a POST request
+// SetRotorStateEndpoint alters the Rotor's State upon a POST request. The
+// response is sent once the rotor arrives; if the client goes away first, the
+// rotor is stopped.
 func SetRotorStateEndpoint(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
-	state := rotor.StateFromJSON(body)
-	rotctl.Rotate(state)
+	state, err := rotor.StateFromJSON(body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	err = rotctl.Rotate(r.Context(), state, rotor.ControllerManual)
+	if isRejection(err) {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+	} else if isConflict(err) {
+		respondWithError(w, http.StatusConflict, err)
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// EmergencyStopEndpoint immediately halts the rotor upon a POST request and
+// latches it stopped (aborting any pass being tracked) until a reset. A rotor
+// that can't halt a move already underway is still latched, and answers with
+// 202 Accepted and a status that isn't "stoppable".
+func EmergencyStopEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Rotor emergency stop requested by %v", r.RemoteAddr)
+	err := rotctl.EmergencyStop()
+	if err == rotor.ErrNotSupported {
+		log.Printf("Rotor can't halt a move already underway; only further commands are blocked")
+		safeRespondWithJSON(w, http.StatusAccepted, rotctl)
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	safeRespondWithJSON(w, http.StatusOK, rotctl)
+}
+
+// ResetEmergencyStopEndpoint releases a latched emergency stop or fault upon a
+// POST request so that the rotor accepts commands again
+func ResetEmergencyStopEndpoint(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Rotor emergency stop and faults reset by %v", r.RemoteAddr)
+	rotctl.ResetEmergencyStop()
+	rotctl.ResetFault()
+	safeRespondWithJSON(w, http.StatusOK, rotctl)
+}
+
+// GetRotorHistoryEndpoint delivers the rotor's recorded commanded and actual
+// positions upon a GET request. The "from" and "to" query parameters (RFC3339
+// times) bound the history, defaulting to the last hour, and the optional
+// "resolution" parameter (e.g. "10s") thins it out to at most one sample per
+// interval. A range holding more than telemetry.MaxSamples samples (at that
+// resolution) is rejected.
+func GetRotorHistoryEndpoint(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := time.Now()
+	if val := q.Get("to"); val != "" {
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-1 * time.Hour)
+	if val := q.Get("from"); val != "" {
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		from = t
+	}
+	var resolution time.Duration
+	if val := q.Get("resolution"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err)
+			return
+		}
+		resolution = d
+	}
+
+	if from.After(to) {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("from (%v) is after to (%v)", from.Format(time.RFC3339), to.Format(time.RFC3339)))
+		return
+	}
+
+	samples, err := telemetryDB.FindBetween(from, to, resolution)
+	if err == telemetry.ErrTooManySamples || err == telemetry.ErrResolution {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		panic(err)
+	}
+	respondWithJSON(w, http.StatusOK, samples)
+}
+
+// GetLeaseEndpoint delivers the rotor's control lease upon a GET request, or
+// a 404 if no lease is held
+func GetLeaseEndpoint(w http.ResponseWriter, r *http.Request) {
+	lease, ok := rotctl.Lease()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, lease)
+}
+
+// AcquireLeaseEndpoint grants an operator exclusive control of the rotor (or
+// renews their lease) upon a PUT request, so that scheduled passes don't take
+// the rotor from them. Setting "force" takes the lease from whoever holds it,
+// aborting any pass being tracked. The "controller" is "manual" (the API) by
+// default, or "rotctld". The request body is in the form:
+// {
+//     "holder": "gavin",
+//     "ttl": "15m",
+//     "force": false
+// }
+func AcquireLeaseEndpoint(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	req := struct {
+		Holder     string           `json:"holder"`
+		Controller rotor.Controller `json:"controller"`
+		TTL        string           `json:"ttl"`
+		Force      bool             `json:"force"`
+	}{Controller: rotor.ControllerManual, TTL: "10m"}
+	if err := json.Unmarshal(body, &req); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Controller != rotor.ControllerManual && req.Controller != rotor.ControllerRotctld {
+		respondWithError(w, http.StatusBadRequest, fmt.Errorf("operators can't hold a lease as the %q controller", req.Controller))
+		return
+	}
+	lease, err := rotctl.AcquireLease(req.Holder, req.Controller, ttl, req.Force)
+	if _, ok := err.(*rotor.LeaseError); ok {
+		respondWithError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	log.Printf("Rotor control lease acquired by %v (%v) from %v until %v", lease.Holder, lease.Controller, r.RemoteAddr, lease.Expires.Format(time.RFC3339))
+	respondWithJSON(w, http.StatusOK, lease)
+}
+
+// ReleaseLeaseEndpoint gives up the operator's control lease upon a DEL
+// request. The holder is given by the "holder" query parameter.
+func ReleaseLeaseEndpoint(w http.ResponseWriter, r *http.Request) {
+	holder := r.URL.Query().Get("holder")
+	if err := rotctl.ReleaseLease(holder); err != nil {
+		respondWithError(w, http.StatusConflict, err)
+		return
+	}
+	log.Printf("Rotor control lease released by %v", holder)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetParkPositionsEndpoint delivers the rotor's named park positions upon a
+// GET request
+func GetParkPositionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, rotctl.ParkPositions())
+}
+
+// ParkEndpoint sends the rotor to one of its named park positions (e.g. stow)
+// upon a POST request. Like SetRotorStateEndpoint, the response is sent once
+// the rotor arrives.
+func ParkEndpoint(w http.ResponseWriter, r *http.Request) {
+	err := rotctl.Park(r.Context(), mux.Vars(r)["name"], rotor.ControllerManual)
+	if err == rotor.ErrUnknownPosition {
+		respondWithError(w, http.StatusNotFound, err)
+	} else if isRejection(err) {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+	} else if isConflict(err) {
+		respondWithError(w, http.StatusConflict, err)
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+	} else {
+		safeRespondWithJSON(w, http.StatusOK, rotctl)
+	}
+}
+
+// HomeEndpoint drives the rotor to its limit or index switches to re-reference
+// its position upon a POST request, responding once homing is complete
+func HomeEndpoint(w http.ResponseWriter, r *http.Request) {
+	err := rotctl.Home(r.Context(), rotor.ControllerManual)
+	if err == rotor.ErrNotSupported {
+		respondWithError(w, http.StatusNotImplemented, err)
+	} else if isConflict(err) {
+		respondWithError(w, http.StatusConflict, err)
+	} else if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err)
+	} else {
+		safeRespondWithJSON(w, http.StatusOK, rotctl)
+	}
+}
+
+// GetCalibrationEndpoint delivers the rotor's Calibration upon a GET request
+func GetCalibrationEndpoint(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, rotctl.Calibration())
+}
+
+// UpdateCalibrationEndpoint replaces the rotor's Calibration upon a PUT
+// request, storing it in MongoDB so that it persists across restarts
+func UpdateCalibrationEndpoint(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var calibration rotor.Calibration
+	if err := json.Unmarshal(body, &calibration); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := calibration.Validate(); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = settingsDB.UpdateCalibration(viper.GetString("RotorName"), calibration)
+	if err != nil {
+		panic(err)
+	}
+	rotctl.SetCalibration(calibration)
+	respondWithJSON(w, http.StatusOK, calibration)
+}
+
+// GetObstructionsEndpoint delivers the rotor's keep-out zones upon a GET request
+func GetObstructionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, rotctl.Obstructions())
+}
+
+// UpdateObstructionsEndpoint replaces the rotor's keep-out zones upon a PUT
+// request, storing them in MongoDB so that they persist across restarts. The
+// request body is in the form:
+// [
+//     {
+//         "name": "roof",
+//         "polygon": [
+//             {"azimuth": 80, "elevation": 0},
+//             {"azimuth": 80, "elevation": 25},
+//             {"azimuth": 110, "elevation": 25},
+//             {"azimuth": 110, "elevation": 0}
+//         ]
+//     }
+// ]
+func UpdateObstructionsEndpoint(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var obstructions []rotor.Obstruction
+	if err := json.Unmarshal(body, &obstructions); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	for _, o := range obstructions {
+		if err := o.Validate(); err != nil {
+			respondWithError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+	err = settingsDB.UpdateObstructions(viper.GetString("RotorName"), obstructions)
+	if err != nil {
+		panic(err)
+	}
+	rotctl.SetObstructions(obstructions)
+	respondWithJSON(w, http.StatusOK, obstructions)
+}
+
+// GetPointingModelEndpoint delivers the rotor's PointingModel upon a GET request
+func GetPointingModelEndpoint(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, rotctl.PointingModel())
+}
+
+// FitPointingModelEndpoint fits a new PointingModel to a set of observations
+// upon a POST request, storing it in MongoDB and applying it to every
+// subsequent rotor command. The request body is in the form:
+// {
+//     "observations": [
+//         {
+//             "commanded": {"azimuth": 120, "elevation": 30},
+//             "observed": {"azimuth": 120.4, "elevation": 29.8}
+//         },
+//         ...
+//     ]
+// }
+func FitPointingModelEndpoint(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var req struct {
+		Observations []rotor.Observation `json:"observations"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		respondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	model, err := rotor.FitPointingModel(req.Observations)
+	if err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = settingsDB.UpdatePointingModel(viper.GetString("RotorName"), model)
+	if err != nil {
+		panic(err)
+	}
+	rotctl.SetPointingModel(model)
+	respondWithJSON(w, http.StatusOK, model)
+}
+
+// DeletePointingModelEndpoint removes the rotor's PointingModel upon a DEL
+// request, so that no pointing corrections are made
+func DeletePointingModelEndpoint(w http.ResponseWriter, r *http.Request) {
+	err := settingsDB.UpdatePointingModel(viper.GetString("RotorName"), rotor.PointingModel{})
+	if err != nil {
+		panic(err)
+	}
+	rotctl.SetPointingModel(rotor.PointingModel{})
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetPassesEndpoint delivers either all TrackingPasses from MongoDB or
@@ -142,6 +640,11 @@ func AddPassEndpoint(w http.ResponseWriter, r *http.Request) {
 	pass := passes.FromJSON(body)
 	pass.ID = bson.NewObjectId()
 	// TODO: implement conflict check
+	if err := pass.Validate(rotctl.Limits()); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	pass.Obstructed = pass.ObstructedSamples(rotctl.Obstructions())
 
 	err = db.Insert(pass)
 	if err != nil {
@@ -176,6 +679,11 @@ func UpdatePassEndpoint(w http.ResponseWriter, r *http.Request) {
 	if pass.ID == bson.ObjectId("") {
 		pass.ID = bson.ObjectIdHex(mux.Vars(r)["id"])
 	}
+	if err := pass.Validate(rotctl.Limits()); err != nil {
+		respondWithError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	pass.Obstructed = pass.ObstructedSamples(rotctl.Obstructions())
 	err = db.Update(pass)
 	if err != nil {
 		panic(err)
@@ -184,6 +692,24 @@ func UpdatePassEndpoint(w http.ResponseWriter, r *http.Request) {
 	go sendUpdate()
 }
 
+// GetPassPlanEndpoint describes how a specific TrackingPass would be tracked
+// from the rotor's current position (flipped or not, whether it fits in the
+// cable wrap, and its peak azimuth rate) upon a GET request
+func GetPassPlanEndpoint(w http.ResponseWriter, r *http.Request) {
+	// panics if ID isn't Mongo-compliant
+	params := mux.Vars(r)
+	pass, err := db.FindByID(params["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// plan within the rotor's current limits, as the executor will
+	planner := passTracker.Planner
+	planner.Limits = rotctl.Limits()
+	plan := planner.Plan(pass, rotctl.MechanicalPosition().Az)
+	respondWithJSON(w, http.StatusOK, plan)
+}
+
 // DeletePassEndpoint deletes a specific TrackingPass in MongoDB upon a DEL request
 func DeletePassEndpoint(w http.ResponseWriter, r *http.Request) {
 	// panics if ID isn't Mongo-compliant
@@ -211,6 +737,50 @@ func respondWithJSON(w http.ResponseWriter, code int, i interface{}) {
 	w.Write(b)
 }
 
+// errorResponse is the JSON body sent along with an error status code. Details
+// carries the fields of a structured error (e.g. which limit was violated).
+type errorResponse struct {
+	Error   string      `json:"error"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+func respondWithError(w http.ResponseWriter, code int, err error) {
+	resp := errorResponse{Error: err.Error()}
+	switch err.(type) {
+	case *rotor.LimitError, *rotor.ObstructionError, *rotor.Fault, *rotor.LeaseError, *rotor.DutyCycleError, *passes.SampleError:
+		resp.Details = err
+	}
+	respondWithJSON(w, code, resp)
+}
+
+// isConflict reports whether a rotor command was refused because of the state
+// the rotor is in (emergency stopped, faulted, unreferenced, leased to someone
+// else or out of duty cycle)
+func isConflict(err error) bool {
+	switch err.(type) {
+	case *rotor.LeaseError, *rotor.DutyCycleError:
+		return true
+	}
+	return err == rotor.ErrEmergencyStop || err == rotor.ErrFaulted || err == rotor.ErrUnreferenced
+}
+
+// notifyFault reports a rotor Fault, which has stopped the rotor (and aborted
+// any pass being tracked)
+func notifyFault(f rotor.Fault) {
+	log.Printf("Rotor %v fault: %v", f.Code, f.Message)
+	integrations.SendSlackFault(f)
+}
+
+// isRejection reports whether a rotor command was refused because of where it
+// would point the rotor (outside its limits or into an obstruction)
+func isRejection(err error) bool {
+	switch err.(type) {
+	case *rotor.LimitError, *rotor.ObstructionError:
+		return true
+	}
+	return false
+}
+
 func safeRespondWithJSON(w http.ResponseWriter, code int, i JSONMarshallable) {
 	b := i.ToJSON()
 	w.Header().Add("Content-Type", "application/json; charset=utf-8")
@@ -229,11 +799,96 @@ func sendUpdate() {
 }
 
 func abortPass() {
-	if passTracker.Engaged {
+	if passTracker.Engaged() {
 		abortCommands <- struct{}{}
 	}
 }
 
+// rotorConfig builds the rotor's Config from the configuration options and
+// the rotor's stored settings
+func rotorConfig(rs settings.RotorSettings) (rotor.Config, error) {
+	parkPositions := make(map[string]rotor.State)
+	for name, key := range map[string]string{rotor.StowPosition: "RotorParkStow", "maintenance": "RotorParkMaintenance", "zenith": "RotorParkZenith"} {
+		s, err := rotor.ParseState(viper.GetString(key))
+		if err != nil {
+			return rotor.Config{}, err
+		}
+		parkPositions[name] = s
+	}
+	return rotor.Config{
+		ParkPositions:   parkPositions,
+		Calibration:     rs.Calibration,
+		PointingModel:   rs.PointingModel,
+		Obstructions:    rs.Obstructions,
+		StallWindow:     viper.GetDuration("RotorStallWindow"),
+		DivergenceLimit: viper.GetFloat64("RotorDivergenceLimit"),
+		DutyCycle:       viper.GetFloat64("RotorDutyCycle"),
+		DutyWindow:      viper.GetDuration("RotorDutyWindow"),
+		OnFault:         notifyFault,
+		Compensation: rotor.Compensation{
+			AzBacklash: viper.GetFloat64("RotorAzimuthBacklash"),
+			ElBacklash: viper.GetFloat64("RotorElevationBacklash"),
+			AzDeadBand: viper.GetFloat64("RotorAzimuthDeadBand"),
+			ElDeadBand: viper.GetFloat64("RotorElevationDeadBand"),
+		},
+		Limits: rotorLimits(),
+	}, nil
+}
+
+// rotorLimits builds the rotor's hardware travel from the configuration
+// options
+func rotorLimits() rotor.Limits {
+	return rotor.Limits{
+		MinAz: viper.GetFloat64("RotorMinAzimuth"),
+		MaxAz: viper.GetFloat64("RotorMaxAzimuth"),
+		MinEl: viper.GetFloat64("RotorMinElevation"),
+		MaxEl: viper.GetFloat64("RotorMaxElevation"),
+	}
+}
+
+// newRotorDriver creates the rotor Driver selected by the RotorDriver
+// configuration option
+func newRotorDriver() (rotor.Driver, error) {
+	switch name := viper.GetString("RotorDriver"); name {
+	case "simulator":
+		config := rotor.SimulatorConfig{
+			MaxRate:      viper.GetFloat64("SimulatorMaxRate"),
+			Acceleration: viper.GetFloat64("SimulatorAcceleration"),
+			SettleTime:   viper.GetDuration("SimulatorSettleTime"),
+			Unreferenced: viper.GetBool("SimulatorUnreferenced"),
+		}
+		return rotor.NewSimulator(rotor.State{Az: 0.0, El: 0.0}, config), nil
+	case "rotctld":
+		return rotor.NewRotctld(viper.GetString("RotctldAddress"), viper.GetDuration("RotctldTimeout"))
+	case "gs232":
+		port, err := rotor.OpenSerial(viper.GetString("RotorSerialPort"), viper.GetInt("RotorSerialBaud"))
+		if err != nil {
+			return nil, err
+		}
+		return rotor.NewGS232(port, viper.GetDuration("RotorSerialTimeout")), nil
+	case "spid":
+		port, err := rotor.OpenSerial(viper.GetString("RotorSerialPort"), viper.GetInt("RotorSerialBaud"))
+		if err != nil {
+			return nil, err
+		}
+		return rotor.NewSPID(port, viper.GetInt("SPIDAzPulses"), viper.GetInt("SPIDElPulses"), viper.GetDuration("RotorSerialTimeout"))
+	case "easycomm":
+		port, err := rotor.OpenSerial(viper.GetString("RotorSerialPort"), viper.GetInt("RotorSerialBaud"))
+		if err != nil {
+			return nil, err
+		}
+		return rotor.NewEasyComm(port, viper.GetInt("EasyCommVersion"), viper.GetDuration("RotorSerialTimeout"))
+	case "modbus":
+		registerMap, err := rotor.ParseModbusMap(viper.GetString("ModbusRegisterMap"))
+		if err != nil {
+			return nil, err
+		}
+		return rotor.NewModbus(viper.GetString("ModbusAddress"), byte(viper.GetInt("ModbusUnitID")), registerMap, rotorLimits(), viper.GetDuration("ModbusTimeout"))
+	default:
+		return nil, fmt.Errorf("unknown ROTOR_DRIVER: %v", name)
+	}
+}
+
 func scheduleSlackCronJob() {
 	dailySendTime, err := time.Parse("15:04", viper.GetString("SlackSchedulePOSTTime"))
 	if err != nil {
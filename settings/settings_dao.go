@@ -0,0 +1,70 @@
+package settings
+
+import (
+	"log"
+
+	"github.com/gavincmartin/rotor-control-service/rotor"
+	mgo "github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// DAO is the data access object for interacting with per-rotor settings
+// (e.g. calibration) stored in MongoDB
+type DAO struct {
+	Server   string
+	Database string
+}
+
+var db *mgo.Database
+
+const (
+	// COLLECTION is the MongoDB collection in which RotorSettings structs are stored
+	COLLECTION = "rotor_settings"
+)
+
+// RotorSettings stores the persistent settings for a single rotor, keyed by
+// the rotor's name
+type RotorSettings struct {
+	Rotor         string              `json:"rotor" bson:"_id"`
+	Calibration   rotor.Calibration   `json:"calibration" bson:"calibration"`
+	PointingModel rotor.PointingModel `json:"pointing_model" bson:"pointing_model"`
+	Obstructions  []rotor.Obstruction `json:"obstructions" bson:"obstructions"`
+}
+
+// Connect connects the DAO to a MongoDB server
+func (d *DAO) Connect() {
+	session, err := mgo.Dial(d.Server)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db = session.DB(d.Database)
+}
+
+// FindByRotor retrieves the RotorSettings for a rotor. A rotor without stored
+// settings gets the defaults (e.g. the identity Calibration).
+func (d *DAO) FindByRotor(name string) (RotorSettings, error) {
+	settings := RotorSettings{Rotor: name}
+	err := db.C(COLLECTION).FindId(name).One(&settings)
+	if err == mgo.ErrNotFound {
+		return RotorSettings{Rotor: name}, nil
+	}
+	return settings, err
+}
+
+// UpdateCalibration stores the Calibration for a rotor
+func (d *DAO) UpdateCalibration(name string, c rotor.Calibration) error {
+	_, err := db.C(COLLECTION).UpsertId(name, bson.M{"$set": bson.M{"calibration": c}})
+	return err
+}
+
+// UpdatePointingModel stores the PointingModel for a rotor
+func (d *DAO) UpdatePointingModel(name string, m rotor.PointingModel) error {
+	_, err := db.C(COLLECTION).UpsertId(name, bson.M{"$set": bson.M{"pointing_model": m}})
+	return err
+}
+
+// UpdateObstructions stores the Obstructions for a rotor
+func (d *DAO) UpdateObstructions(name string, obs []rotor.Obstruction) error {
+	_, err := db.C(COLLECTION).UpsertId(name, bson.M{"$set": bson.M{"obstructions": obs}})
+	return err
+}
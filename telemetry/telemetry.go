@@ -0,0 +1,44 @@
+package telemetry
+
+import (
+	"log"
+	"time"
+
+	"github.com/gavincmartin/rotor-control-service/rotor"
+)
+
+// Sample records where the rotor was commanded to point and where it actually
+// pointed at a moment in time
+type Sample struct {
+	Time time.Time `json:"time" bson:"time"`
+	// Commanded is the rotor's most recent target (nil if it hasn't been
+	// commanded since the service started)
+	Commanded *rotor.State `json:"commanded,omitempty" bson:"commanded,omitempty"`
+	// Controller issued the Commanded position (e.g. "manual" or "executor")
+	Controller rotor.Controller `json:"controller,omitempty" bson:"controller,omitempty"`
+	Actual     rotor.State      `json:"actual" bson:"actual"`
+}
+
+// Recorder samples a Rotor's commanded and actual positions every Interval,
+// storing them in MongoDB
+type Recorder struct {
+	Rotctl   *rotor.Rotor
+	DB       DAO
+	Interval time.Duration
+}
+
+// Run records Samples until the service exits
+func (rec *Recorder) Run() {
+	ticker := time.NewTicker(rec.Interval)
+	defer ticker.Stop()
+	failing := false
+	for now := range ticker.C {
+		status := rec.Rotctl.Status()
+		s := Sample{Time: now.UTC(), Commanded: status.Target, Controller: status.Controller, Actual: status.State}
+		err := rec.DB.Insert(s)
+		if err != nil && !failing {
+			log.Printf("Failed to record rotor telemetry: %v", err)
+		}
+		failing = err != nil
+	}
+}
@@ -0,0 +1,98 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	mgo "github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+)
+
+// DAO is the data access object for interacting with telemetry Samples
+// stored in MongoDB
+type DAO struct {
+	Server   string
+	Database string
+}
+
+var db *mgo.Database
+
+const (
+	// COLLECTION is the MongoDB collection in which Samples are stored
+	COLLECTION = "rotor_telemetry"
+	// MaxSamples is the most Samples FindBetween will return
+	MaxSamples = 10000
+)
+
+// ErrTooManySamples is returned by FindBetween when the time range holds more
+// than MaxSamples (at the requested resolution)
+var ErrTooManySamples = fmt.Errorf("telemetry: more than %d samples in range; narrow it or set a coarser resolution", MaxSamples)
+
+// ErrResolution is returned by FindBetween for a resolution finer than a
+// millisecond, which is as precisely as MongoDB stores times
+var ErrResolution = errors.New("telemetry: resolution must be at least 1ms")
+
+// Connect connects the DAO to a MongoDB server
+func (d *DAO) Connect() {
+	session, err := mgo.Dial(d.Server)
+	if err != nil {
+		log.Fatal(err)
+	}
+	db = session.DB(d.Database)
+}
+
+// EnsureIndex indexes Samples by time, expiring them once they are older than
+// retention (0 keeps them forever)
+func (d *DAO) EnsureIndex(retention time.Duration) error {
+	index := mgo.Index{Key: []string{"time"}, ExpireAfter: retention}
+	err := db.C(COLLECTION).EnsureIndex(index)
+	if err != nil {
+		// the retention has changed since the index was created, so replace it
+		if err := db.C(COLLECTION).DropIndex("time"); err != nil {
+			return err
+		}
+		err = db.C(COLLECTION).EnsureIndex(index)
+	}
+	return err
+}
+
+// Insert adds a Sample to MongoDB
+func (d *DAO) Insert(s Sample) error {
+	return db.C(COLLECTION).Insert(&s)
+}
+
+// FindBetween retrieves the Samples taken between two times (inclusive) in
+// order. If resolution is set, they are thinned out by MongoDB to at most one
+// per interval of that length, keeping the first Sample in each. Rather than
+// return more than MaxSamples, it fails with ErrTooManySamples.
+func (d *DAO) FindBetween(from, to time.Time, resolution time.Duration) ([]Sample, error) {
+	match := bson.M{"time": bson.M{"$gte": from, "$lte": to}}
+	var samples []Sample
+	var err error
+	switch {
+	case resolution == 0:
+		err = db.C(COLLECTION).Find(match).Sort("time").Limit(MaxSamples + 1).All(&samples)
+	case resolution < time.Millisecond:
+		return nil, ErrResolution
+	default:
+		// group the Samples by the interval (counted in milliseconds since
+		// the epoch) they fall in
+		ms := bson.M{"$subtract": []interface{}{"$time", time.Unix(0, 0)}}
+		interval := bson.M{"$subtract": []interface{}{ms, bson.M{"$mod": []interface{}{ms, int64(resolution / time.Millisecond)}}}}
+		pipeline := []bson.M{
+			{"$match": match},
+			{"$sort": bson.M{"time": 1}},
+			{"$group": bson.M{"_id": interval, "sample": bson.M{"$first": "$$ROOT"}}},
+			{"$sort": bson.M{"_id": 1}},
+			{"$limit": MaxSamples + 1},
+			{"$replaceRoot": bson.M{"newRoot": "$sample"}},
+		}
+		err = db.C(COLLECTION).Pipe(pipeline).AllowDiskUse().All(&samples)
+	}
+	if err == nil && len(samples) > MaxSamples {
+		return nil, ErrTooManySamples
+	}
+	return samples, err
+}